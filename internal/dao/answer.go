@@ -2,7 +2,8 @@ package dao
 
 import (
 	"context"
-	"errors"
+	"regexp"
+	"time"
 
 	database "QA-System/internal/pkg/database/mongodb"
 	"go.mongodb.org/mongo-driver/bson"
@@ -14,19 +15,40 @@ import (
 
 // Answer 各问题答卷模型
 type Answer struct {
-	QuestionID int    `json:"question_id" bson:"questionid"` // 问题ID
-	SerialNum  int    `json:"serial_num" bson:"serialnum"`   // 问题序号
-	Subject    string `json:"subject" bson:"subject"`        // 问题标题
-	Content    string `json:"content" bson:"content"`        // 答案内容
+	QuestionID int    `json:"question_id" bson:"questionid"`              // 问题ID
+	SerialNum  int    `json:"serial_num" bson:"serialnum"`                // 问题序号
+	Subject    string `json:"subject" bson:"subject"`                     // 问题标题
+	Content    string `json:"content" bson:"content"`                     // 答案内容
+	Correct    *bool  `json:"correct,omitempty" bson:"correct,omitempty"` // 测验题目是否回答正确, 未批改时为空
 }
 
 // AnswerSheet mongodb答卷表模型
 type AnswerSheet struct {
-	SurveyID int                `json:"survey_id" bson:"surveyid"` // 问卷ID
-	AnswerID primitive.ObjectID `json:"answer_id" bson:"_id"`      // 答卷ID
-	Time     string             `json:"time" bson:"time"`          // 答卷时间
-	Unique   bool               `json:"unique" bson:"unique"`      // 是否唯一
-	Answers  []Answer           `json:"answers" bson:"answers"`    // 答案列表
+	SurveyID  int                `json:"survey_id" bson:"surveyid"`                  // 问卷ID
+	AnswerID  primitive.ObjectID `json:"answer_id" bson:"_id"`                       // 答卷ID
+	Time      string             `json:"time" bson:"time"`                           // 答卷时间
+	Unique    bool               `json:"unique" bson:"unique"`                       // 是否唯一
+	Answers   []Answer           `json:"answers" bson:"answers"`                     // 答案列表
+	Score     uint               `json:"score" bson:"score"`                         // 测验得分
+	StudentID string             `json:"-" bson:"studentid,omitempty"`               // 填写者学号, 仅允许修改答卷的问卷记录
+	History   []AnswerRevision   `json:"history,omitempty" bson:"history,omitempty"` // 修改记录
+	Meta      *SubmitMeta        `json:"-" bson:"meta,omitempty"`                    // 提交信息
+	Invalid   bool               `json:"invalid" bson:"invalid,omitempty"`           // 是否被管理员标记为无效, 无效答卷不计入统计
+}
+
+// SubmitMeta 答卷提交信息, 用于识别刷票
+type SubmitMeta struct {
+	IP            string `json:"ip,omitempty" bson:"ip,omitempty"` // 提交IP, 匿名问卷不记录
+	IPRange       string `json:"ip_range" bson:"iprange"`          // 提交IP所在网段
+	UserAgentHash string `json:"user_agent_hash" bson:"uahash"`    // User-Agent 的哈希
+	Duration      int64  `json:"duration" bson:"duration"`         // 从获取问卷到提交的秒数 0为未知
+}
+
+// AnswerRevision 答卷修改前的历史版本
+type AnswerRevision struct {
+	Time    string   `json:"time" bson:"time"`       // 答卷时间
+	Answers []Answer `json:"answers" bson:"answers"` // 答案列表
+	Score   uint     `json:"score" bson:"score"`     // 测验得分
 }
 
 // QuestionAnswers 问题答案模型
@@ -44,127 +66,125 @@ type AnswersResonse struct {
 }
 
 // SaveAnswerSheet 将答卷直接保存到 MongoDB 集合中
-func (d *Dao) SaveAnswerSheet(ctx context.Context, answerSheet AnswerSheet, qids []int) error {
-	// 构建查询条件
-	matchConditions := make([]bson.M, 0) // 初始化为空切片
-	for _, answer := range answerSheet.Answers {
-		if contains(qids, answer.QuestionID) {
-			matchConditions = append(matchConditions, bson.M{
-				"answers": bson.M{
-					"$elemMatch": bson.M{
-						"questionid": answer.QuestionID,
-						"content":    answer.Content,
-					},
-				},
-			})
-		}
-	}
-
-	if len(matchConditions) == 0 {
-		// 没有符合条件的记录，直接插入新记录
-		_, err := d.mongo.Collection(database.QA).InsertOne(ctx, answerSheet)
-		if err != nil {
-			return err
-		}
-		return nil
-	}
-
-	filter := bson.M{
-		"unique": true,
-		"$or":    matchConditions,
-	}
-
-	var result AnswerSheet
-	err := d.mongo.Collection(database.QA).FindOne(ctx, filter).Decode(&result)
-	if err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			// 没有找到符合条件的记录，直接插入新记录
-			_, err := d.mongo.Collection(database.QA).InsertOne(ctx, answerSheet)
-			if err != nil {
-				return err
-			}
-			return nil
-		}
-		return err
-	}
+func (d *Dao) SaveAnswerSheet(ctx context.Context, answerSheet AnswerSheet) error {
+	_, err := d.mongo.Collection(database.QA).InsertOne(ctx, answerSheet)
+	return err
+}
 
-	// 更新找到的记录，将unique设为false
+// ReplaceAnswerSheet 用修改后的答卷替换原答卷, 原答卷内容保存到修改记录中
+func (d *Dao) ReplaceAnswerSheet(ctx context.Context, answerSheet AnswerSheet, previous AnswerSheet) error {
 	update := bson.M{
-		"$set": bson.M{"unique": false},
-	}
-	_, err = d.mongo.Collection(database.QA).UpdateOne(ctx, filter, update)
-	if err != nil {
-		return err
+		"$set": bson.M{
+			"time":    answerSheet.Time,
+			"unique":  true,
+			"answers": answerSheet.Answers,
+			"score":   answerSheet.Score,
+		},
+		"$push": bson.M{
+			"history": AnswerRevision{
+				Time:    previous.Time,
+				Answers: previous.Answers,
+				Score:   previous.Score,
+			},
+		},
 	}
+	_, err := d.mongo.Collection(database.QA).UpdateOne(ctx, bson.M{"_id": previous.AnswerID}, update)
+	return err
+}
 
-	// 新增一条记录
-	newAnswerSheet := AnswerSheet{
-		SurveyID: answerSheet.SurveyID,
-		Time:     answerSheet.Time,
-		Unique:   true,
-		Answers:  answerSheet.Answers,
-	}
+// 问题答案的匹配方式
+const (
+	MatchEqual    = "eq"       // 答案与值完全相同
+	MatchContains = "contains" // 答案包含值, 不区分大小写
+	MatchOption   = "option"   // 选择了值对应的选项, 多选题答案以┋分隔
+)
 
-	_, err = d.mongo.Collection(database.QA).InsertOne(ctx, newAnswerSheet)
-	if err != nil {
-		return err
-	}
+// answerTimeLayout 答卷时间的格式, 按字符串比较即可比较先后
+const answerTimeLayout = "2006-01-02 15:04:05"
 
-	return nil
+// AnswerFilter 答卷筛选条件, 答卷列表、导出和统计共用
+type AnswerFilter struct {
+	Text      string           // 任一答案包含的文本, 按字面匹配且不区分大小写
+	Unique    bool             // 只包含唯一且未被标记为无效的答卷
+	From      time.Time        // 提交时间范围, 零值为不限制
+	To        time.Time        // 提交时间范围, 零值为不限制
+	Questions []QuestionFilter // 指定问题的答案条件, 需全部满足
 }
 
-func contains(arr []int, item int) bool {
-	for _, a := range arr {
-		if a == item {
-			return true
-		}
-	}
-	return false
+// QuestionFilter 指定问题的答案条件
+type QuestionFilter struct {
+	QuestionID int
+	Match      string // 匹配方式
+	Value      string
 }
 
-// GetAnswerSheetBySurveyID 根据问卷ID分页获取答卷
-func (d *Dao) GetAnswerSheetBySurveyID(
-	ctx context.Context, surveyID int, pageNum int, pageSize int, text string, unique bool) (
-	[]AnswerSheet, *int64, error) {
-	answerSheets := make([]AnswerSheet, 0)
-	filter := bson.M{"surveyid": surveyID}
+// AnswerPage 答卷分页条件, 按答卷ID升序返回
+type AnswerPage struct {
+	After primitive.ObjectID // 游标, 非零时只返回ID大于它的答卷
+	Skip  int64              // 未使用游标时跳过的答卷数
+	Limit int64              // 0为不限制
+}
 
-	// 如果 text 不为空，添加 text 的查询条件
-	if text != "" {
-		filter["answers.content"] = bson.M{"$regex": text, "$options": "i"} // i 表示不区分大小写
+// answerSheetQuery 构建问卷答卷的查询条件
+func answerSheetQuery(surveyID int, filter AnswerFilter) bson.M {
+	query := bson.M{"surveyid": surveyID}
+	if filter.Text != "" {
+		query["answers.content"] = bson.M{"$regex": regexp.QuoteMeta(filter.Text), "$options": "i"}
 	}
-
-	// 如果 unique 为 true，添加 unique 的查询条件
-	if unique {
-		filter["unique"] = true
+	// 只统计唯一答卷时排除被标记为无效的答卷
+	if filter.Unique {
+		query["unique"] = true
+		query["invalid"] = bson.M{"$ne": true}
 	}
-
-	// 设置总记录数查询过滤条件和选项
-	countFilter := filter
-	countOpts := options.Count()
-
-	// 执行总记录数查询
-	total, err := d.mongo.Collection(database.QA).CountDocuments(ctx, countFilter, countOpts)
-	if err != nil {
-		return nil, nil, err
+	timeRange := bson.M{}
+	if !filter.From.IsZero() {
+		timeRange["$gte"] = filter.From.In(time.Local).Format(answerTimeLayout)
 	}
-
-	// 查询分页超过总页数
-	if pageSize != 0 && int64(pageNum) > total/int64(pageSize)+1 {
-		return nil, nil, errors.New("页数超出范围")
+	if !filter.To.IsZero() {
+		timeRange["$lte"] = filter.To.In(time.Local).Format(answerTimeLayout)
+	}
+	if len(timeRange) > 0 {
+		query["time"] = timeRange
 	}
+	conditions := make(bson.A, 0, len(filter.Questions))
+	for _, q := range filter.Questions {
+		var content any
+		switch q.Match {
+		case MatchContains:
+			content = bson.M{"$regex": regexp.QuoteMeta(q.Value), "$options": "i"}
+		case MatchOption:
+			content = bson.M{"$regex": "(^|┋)" + regexp.QuoteMeta(q.Value) + "(┋|$)"}
+		default:
+			content = q.Value
+		}
+		conditions = append(conditions, bson.M{
+			"answers": bson.M{"$elemMatch": bson.M{"questionid": q.QuestionID, "content": content}},
+		})
+	}
+	if len(conditions) > 0 {
+		query["$and"] = conditions
+	}
+	return query
+}
 
-	// 设置分页查询选项
-	opts := options.Find()
-	if pageNum != 0 && pageSize != 0 {
-		opts.SetSkip(int64((pageNum - 1) * pageSize)) // 计算要跳过的文档数
-		opts.SetLimit(int64(pageSize))                // 设置返回的文档数
+// GetAnswerSheetBySurveyID 根据问卷ID按条件获取答卷
+func (d *Dao) GetAnswerSheetBySurveyID(
+	ctx context.Context, surveyID int, filter AnswerFilter, page AnswerPage) ([]AnswerSheet, error) {
+	answerSheets := make([]AnswerSheet, 0)
+	query := answerSheetQuery(surveyID, filter)
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}})
+	if !page.After.IsZero() {
+		query["_id"] = bson.M{"$gt": page.After}
+	} else if page.Skip > 0 {
+		opts.SetSkip(page.Skip)
+	}
+	if page.Limit > 0 {
+		opts.SetLimit(page.Limit)
 	}
 
-	// 执行分页查询
-	cur, err := d.mongo.Collection(database.QA).Find(ctx, filter, opts)
+	cur, err := d.mongo.Collection(database.QA).Find(ctx, query, opts)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 	defer func(cur *mongo.Cursor, ctx context.Context) {
 		err := cur.Close(ctx)
@@ -178,15 +198,19 @@ func (d *Dao) GetAnswerSheetBySurveyID(
 	for cur.Next(ctx) {
 		var answerSheet AnswerSheet
 		if err := cur.Decode(&answerSheet); err != nil {
-			return nil, nil, err
+			return nil, err
 		}
 		answerSheets = append(answerSheets, answerSheet)
 	}
 	if err := cur.Err(); err != nil {
-		return nil, nil, err
+		return nil, err
 	}
-	// 返回分页数据和总记录数
-	return answerSheets, &total, nil
+	return answerSheets, nil
+}
+
+// CountAnswerSheets 统计问卷中符合条件的答卷数
+func (d *Dao) CountAnswerSheets(ctx context.Context, surveyID int, filter AnswerFilter) (int64, error) {
+	return d.mongo.Collection(database.QA).CountDocuments(ctx, answerSheetQuery(surveyID, filter))
 }
 
 // DeleteAnswerSheetBySurveyID 根据问卷ID删除答卷
@@ -206,9 +230,41 @@ func (d *Dao) DeleteAnswerSheetByAnswerID(ctx context.Context, answerID primitiv
 }
 
 // GetAnswerSheetByAnswerID 根据答卷ID获取答卷
-func (d *Dao) GetAnswerSheetByAnswerID(ctx context.Context, answerID primitive.ObjectID) error {
+func (d *Dao) GetAnswerSheetByAnswerID(ctx context.Context, answerID primitive.ObjectID) (*AnswerSheet, error) {
 	var answerSheet AnswerSheet
 	filter := bson.M{"_id": answerID}
 	err := d.mongo.Collection(database.QA).FindOne(ctx, filter).Decode(&answerSheet)
-	return err
+	return &answerSheet, err
+}
+
+// GetLatestAnswerSheetByStudentID 获取填写者在问卷中最近提交的答卷
+func (d *Dao) GetLatestAnswerSheetByStudentID(ctx context.Context, surveyID int, stuId string) (*AnswerSheet, error) {
+	var answerSheet AnswerSheet
+	filter := bson.M{"surveyid": surveyID, "studentid": stuId}
+	opts := options.FindOne().SetSort(bson.M{"_id": -1})
+	err := d.mongo.Collection(database.QA).FindOne(ctx, filter, opts).Decode(&answerSheet)
+	return &answerSheet, err
+}
+
+// UnsetAnswerSheetStudentIDs 清除问卷答卷中记录的填写者学号, 返回修改的答卷数
+func (d *Dao) UnsetAnswerSheetStudentIDs(ctx context.Context, surveyIDs []int) (int64, error) {
+	filter := bson.M{"surveyid": bson.M{"$in": surveyIDs}, "studentid": bson.M{"$exists": true}}
+	update := bson.M{"$unset": bson.M{"studentid": ""}}
+	result, err := d.mongo.Collection(database.QA).UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// SetAnswerSheetsInvalid 标记或取消标记问卷中的答卷为无效, 返回修改的答卷数
+func (d *Dao) SetAnswerSheetsInvalid(ctx context.Context, surveyID int, answerIDs []primitive.ObjectID, invalid bool) (
+	int64, error) {
+	filter := bson.M{"surveyid": surveyID, "_id": bson.M{"$in": answerIDs}}
+	update := bson.M{"$set": bson.M{"invalid": invalid}}
+	result, err := d.mongo.Collection(database.QA).UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
 }
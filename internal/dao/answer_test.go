@@ -0,0 +1,28 @@
+package dao
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestAnswerSheetQueryTimeRangeUsesLocalTime(t *testing.T) {
+	local := time.Local
+	time.Local = time.FixedZone("CST", 8*60*60)
+	defer func() { time.Local = local }()
+
+	from := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 5, 1, 10, 30, 0, 0, time.FixedZone("", -4*60*60))
+	query := answerSheetQuery(1, AnswerFilter{From: from, To: to})
+	timeRange, ok := query["time"].(bson.M)
+	if !ok {
+		t.Fatalf("query[time] = %v, want time range", query["time"])
+	}
+	if got := timeRange["$gte"]; got != "2024-05-01 08:00:00" {
+		t.Errorf("$gte = %v, want 2024-05-01 08:00:00", got)
+	}
+	if got := timeRange["$lte"]; got != "2024-05-01 22:30:00" {
+		t.Errorf("$lte = %v, want 2024-05-01 22:30:00", got)
+	}
+}
@@ -0,0 +1,78 @@
+package dao
+
+import (
+	"context"
+	"time"
+
+	"QA-System/internal/model"
+)
+
+// CreateInvitations 批量创建邀请
+func (d *Dao) CreateInvitations(ctx context.Context, invitations []model.Invitation) error {
+	if len(invitations) == 0 {
+		return nil
+	}
+	err := d.orm.WithContext(ctx).CreateInBatches(&invitations, 500).Error
+	return err
+}
+
+// GetInvitationsBySurveyID 根据问卷ID获取邀请, status 为 0 时获取全部
+func (d *Dao) GetInvitationsBySurveyID(ctx context.Context, surveyID int, status int) ([]model.Invitation, error) {
+	var invitations []model.Invitation
+	db := d.orm.WithContext(ctx).Where("survey_id = ?", surveyID)
+	if status != 0 {
+		db = db.Where("status = ?", status)
+	}
+	err := db.Order("id").Find(&invitations).Error
+	return invitations, err
+}
+
+// GetInvitationByID 根据邀请ID获取邀请
+func (d *Dao) GetInvitationByID(ctx context.Context, id int) (*model.Invitation, error) {
+	var invitation model.Invitation
+	err := d.orm.WithContext(ctx).Where("id = ?", id).First(&invitation).Error
+	return &invitation, err
+}
+
+// GetInvitationByToken 根据问卷ID和邀请令牌获取邀请
+func (d *Dao) GetInvitationByToken(ctx context.Context, surveyID int, token string) (*model.Invitation, error) {
+	var invitation model.Invitation
+	err := d.orm.WithContext(ctx).Where("survey_id = ? AND token = ?", surveyID, token).First(&invitation).Error
+	return &invitation, err
+}
+
+// UseInvitation 将未使用的邀请标记为已使用, 邀请已被使用或撤销时返回 false
+func (d *Dao) UseInvitation(ctx context.Context, surveyID int, token string) (bool, error) {
+	result := d.orm.WithContext(ctx).Model(&model.Invitation{}).
+		Where("survey_id = ? AND token = ? AND status = ?", surveyID, token, 1).
+		Updates(map[string]any{"status": 2, "used_at": time.Now()})
+	return result.RowsAffected > 0, result.Error
+}
+
+// ReleaseInvitation 将已使用的邀请恢复为未使用
+func (d *Dao) ReleaseInvitation(ctx context.Context, surveyID int, token string) error {
+	err := d.orm.WithContext(ctx).Model(&model.Invitation{}).
+		Where("survey_id = ? AND token = ? AND status = ?", surveyID, token, 2).
+		Updates(map[string]any{"status": 1, "used_at": nil}).Error
+	return err
+}
+
+// UpdateInvitationAnswerID 记录邀请对应的答卷ID
+func (d *Dao) UpdateInvitationAnswerID(ctx context.Context, surveyID int, token string, answerID string) error {
+	err := d.orm.WithContext(ctx).Model(&model.Invitation{}).
+		Where("survey_id = ? AND token = ?", surveyID, token).Update("answer_id", answerID).Error
+	return err
+}
+
+// RevokeInvitation 撤销未使用的邀请, 邀请已被使用时返回 false
+func (d *Dao) RevokeInvitation(ctx context.Context, id int) (bool, error) {
+	result := d.orm.WithContext(ctx).Model(&model.Invitation{}).
+		Where("id = ? AND status = ?", id, 1).Update("status", 3)
+	return result.RowsAffected > 0, result.Error
+}
+
+// DeleteInvitationsBySurveyID 根据问卷ID删除邀请
+func (d *Dao) DeleteInvitationsBySurveyID(ctx context.Context, surveyID int) error {
+	err := d.orm.WithContext(ctx).Where("survey_id = ?", surveyID).Delete(&model.Invitation{}).Error
+	return err
+}
@@ -16,6 +16,7 @@ type Option struct {
 	Content     string `json:"content"`     // 选项内容
 	Description string `json:"description"` // 选项描述
 	Img         string `json:"img"`         // 图片
+	Pinned      bool   `json:"pinned"`      // 打乱选项顺序时是否固定在原位置
 }
 
 // CreateOption 创建选项
@@ -35,7 +36,8 @@ func (d *Dao) GetOptionsByQuestionID(ctx context.Context, questionID int) ([]mod
 			return options, nil
 		}
 	}
-	err = d.orm.WithContext(ctx).Model(model.Option{}).Where("question_id = ?", questionID).Find(&options).Error
+	err = d.orm.WithContext(ctx).Model(model.Option{}).Where("question_id = ?", questionID).
+		Order("serial_num").Find(&options).Error
 	if err != nil {
 		return nil, err
 	}
@@ -64,7 +66,7 @@ func (d *Dao) GetOptionByQIDAndAnswer(ctx context.Context, qid int, answer strin
 	cachedData, err := redis.RedisClient.Get(ctx, fmt.Sprintf("option:qid:%d:answer:%s", qid, answer)).Result()
 	if err == nil && cachedData != "" {
 		// 反序列化 JSON 为结构体
-		if err := json.Unmarshal([]byte(cachedData), option); err == nil {
+		if err := json.Unmarshal([]byte(cachedData), &option); err == nil {
 			return &option, nil
 		}
 	}
@@ -85,10 +87,10 @@ func (d *Dao) GetOptionByQIDAndAnswer(ctx context.Context, qid int, answer strin
 func (d *Dao) GetOptionByQIDAndSerialNum(ctx context.Context, qid int, serialNum int) (*model.Option, error) {
 	var option model.Option
 	// 从 Redis 获取
-	cachedData, err := redis.RedisClient.Get(ctx, fmt.Sprintf("option:qid:%d:serial_num:%s", qid, serialNum)).Result()
+	cachedData, err := redis.RedisClient.Get(ctx, fmt.Sprintf("option:qid:%d:serial_num:%d", qid, serialNum)).Result()
 	if err == nil && cachedData != "" {
 		// 反序列化 JSON 为结构体
-		if err := json.Unmarshal([]byte(cachedData), option); err == nil {
+		if err := json.Unmarshal([]byte(cachedData), &option); err == nil {
 			return &option, nil
 		}
 	}
@@ -100,7 +102,7 @@ func (d *Dao) GetOptionByQIDAndSerialNum(ctx context.Context, qid int, serialNum
 	// 序列化为 JSON 后存储到 Redis
 	jsonData, err := json.Marshal(option)
 	if err == nil {
-		redis.RedisClient.Set(ctx, fmt.Sprintf("option:qid:%d:serial_num:%s", qid, serialNum), jsonData, 20*time.Minute)
+		redis.RedisClient.Set(ctx, fmt.Sprintf("option:qid:%d:serial_num:%d", qid, serialNum), jsonData, 20*time.Minute)
 	}
 	return &option, err
 }
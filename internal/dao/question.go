@@ -12,23 +12,57 @@ import (
 
 // BaseConfig 基本配置模型
 type BaseConfig struct {
-	StartTime  string `json:"start_time" binding:"datetime=2006-01-02T15:04:05+08:00"`
-	EndTime    string `json:"end_time" binding:"datetime=2006-01-02T15:04:05+08:00"`
-	DailyLimit uint   `json:"day_limit"` // 问卷每日填写限制
-	SumLimit   uint   `json:"sum_limit"` // 问卷总填写次数限制
-	Verify     bool   `json:"verify"`    // 问卷是否需要统一验证
+	StartTime      string      `json:"start_time" binding:"datetime=2006-01-02T15:04:05+08:00"`
+	EndTime        string      `json:"end_time" binding:"datetime=2006-01-02T15:04:05+08:00"`
+	DailyLimit     uint        `json:"day_limit"`       // 问卷每日填写限制
+	SumLimit       uint        `json:"sum_limit"`       // 问卷总填写次数限制
+	Verify         bool        `json:"verify"`          // 问卷是否需要统一验证
+	MaxNum         uint        `json:"max_num"`         // 问卷最大填写数量 0为不限制
+	Shuffle        bool        `json:"shuffle"`         // 是否打乱题目顺序
+	DrawNum        uint        `json:"draw_num"`        // 每位填写者从题库中抽取的题目数 0为不抽题
+	ShowScore      bool        `json:"show_score"`      // 测验提交后是否向填写者展示得分和解析
+	AllowEdit      bool        `json:"allow_edit"`      // 问卷截止前是否允许填写者修改已提交的答卷
+	Anonymous      bool        `json:"anonymous"`       // 统一验证问卷是否匿名, 匿名时不保存可与答卷关联的身份信息
+	AccessCode     string      `json:"access_code"`     // 问卷访问码 空为不需要
+	InviteOnly     bool        `json:"invite_only"`     // 是否仅允许持有邀请链接的人填写, 每个邀请只能提交一次
+	ProofOfWork    bool        `json:"proof_of_work"`   // 提交时是否需要完成工作量证明
+	IPLimit        uint        `json:"ip_limit"`        // 每个IP每日提交次数限制 0为不限制
+	DeviceLimit    uint        `json:"device_limit"`    // 每台设备每日提交次数限制 0为不限制
+	UniqueMode     uint        `json:"unique_mode"`     // 唯一问题答案重复时的处理方式 0:拒绝提交 1:保留最新答卷
+	ResultVisible  uint        `json:"result_visible"`  // 投票结果可见范围 0:公开 1:截止后公开 2:仅已投票者 3:仅管理员
+	ResultTopN     uint        `json:"result_top_n"`    // 投票结果每题只公开排名前N的选项 0为全部公开
+	ReceiptAnswers bool        `json:"receipt_answers"` // 凭提交回执是否可查看已提交的答案
+	Eligibility    Eligibility `json:"eligibility"`     // 统一验证问卷的填写资格
+}
+
+// Eligibility 填写资格模型, 各项为空时不限制
+type Eligibility struct {
+	UserTypes     []string `json:"user_types"`      // 允许填写的用户类型, 如本科生、研究生
+	Colleges      []string `json:"colleges"`        // 允许填写的学院
+	Genders       []string `json:"genders"`         // 允许填写的性别
+	StuIDPrefixes []string `json:"stu_id_prefixes"` // 允许填写的学号前缀, 可用于限制年级
 }
 
 // QuestionConfig 问题配置模型
 type QuestionConfig struct {
 	Desc         string         `json:"desc" `
 	Title        string         `json:"title"`
+	Sections     []SectionList  `json:"sections"`
 	QuestionList []QuestionList `json:"question_list"`
 }
 
+// SectionList 分页列表模型
+type SectionList struct {
+	SerialNum   int    `json:"serial_num"`  // 分页序号
+	Title       string `json:"title"`       // 分页标题
+	Description string `json:"description"` // 分页描述
+	Img         string `json:"img"`         // 分页图片
+}
+
 // QuestionList 问题列表模型
 type QuestionList struct {
 	SerialNum       int             `json:"serial_num"`   // 题目序号
+	SectionNum      int             `json:"section_num"`  // 所属分页序号 0为不分页
 	Subject         string          `json:"subject"`      // 问题
 	Description     string          `json:"description"`  // 问题描述
 	Img             string          `json:"img"`          // 图片
@@ -38,14 +72,19 @@ type QuestionList struct {
 
 // QuestionSetting 问题设置模型
 type QuestionSetting struct {
-	Required      bool     `json:"required"`                                           // 是否必填
-	Unique        bool     `json:"unique"`                                             // 是否唯一
-	OtherOption   bool     `json:"other_option"`                                       // 是否有其他选项
-	QuestionType  int      `json:"question_type" binding:"required,oneof=1 2 3 4 5 6"` // 问题类型 1单选2多选3填空4简答5图片6文件
-	Reg           string   `json:"reg"`                                                // 正则表达式
-	Options       []Option `json:"options"`                                            // 选项
-	MaximumOption uint     `json:"maximum_option"`                                     // 多选最多选项数 0为不限制
-	MinimumOption uint     `json:"minimum_option"`                                     // 多选最少选项数 0为不限制
+	Required      bool     `json:"required"`                                             // 是否必填
+	Unique        bool     `json:"unique"`                                               // 是否唯一
+	OtherOption   bool     `json:"other_option"`                                         // 是否有其他选项
+	QuestionType  int      `json:"question_type" binding:"required,oneof=1 2 3 4 5 6 7"` // 问题类型 1单选2多选3填空4简答5图片6文件7展示块
+	Reg           string   `json:"reg"`                                                  // 正则表达式
+	Options       []Option `json:"options"`                                              // 选项
+	MaximumOption uint     `json:"maximum_option"`                                       // 多选最多选项数 0为不限制
+	MinimumOption uint     `json:"minimum_option"`                                       // 多选最少选项数 0为不限制
+	Shuffle       bool     `json:"shuffle"`                                              // 是否打乱选项顺序
+	InBank        bool     `json:"in_bank"`                                              // 是否为题库题目
+	CorrectAnswer string   `json:"correct_answer"`                                       // 测验正确答案, 多个以┋分隔
+	Points        uint     `json:"points"`                                               // 测验题目分值
+	Explanation   string   `json:"explanation"`                                          // 测验答案解析
 }
 
 // QuestionsList 问题列表模型
@@ -70,7 +109,8 @@ func (d *Dao) GetQuestionsBySurveyID(ctx context.Context, surveyID int) ([]model
 			return questions, nil
 		}
 	}
-	err = d.orm.WithContext(ctx).Model(model.Question{}).Where("survey_id = ?", surveyID).Find(&questions).Error
+	err = d.orm.WithContext(ctx).Model(model.Question{}).Where("survey_id = ?", surveyID).
+		Order("serial_num").Find(&questions).Error
 	if err != nil {
 		return nil, err
 	}
@@ -82,6 +122,14 @@ func (d *Dao) GetQuestionsBySurveyID(ctx context.Context, surveyID int) ([]model
 	return questions, err
 }
 
+// GetUniqueQuestions 获取所有问卷中需要唯一的填空题
+func (d *Dao) GetUniqueQuestions(ctx context.Context) ([]model.Question, error) {
+	var questions []model.Question
+	err := d.orm.WithContext(ctx).Where(&model.Question{QuestionType: 3, Unique: true}).
+		Order("survey_id").Find(&questions).Error
+	return questions, err
+}
+
 // GetQuestionByID 根据问题ID获取问题
 func (d *Dao) GetQuestionByID(ctx context.Context, questionID int) (*model.Question, error) {
 	var question model.Question
@@ -5,18 +5,22 @@ import (
 	"time"
 
 	database "QA-System/internal/pkg/database/mongodb"
+	"github.com/google/uuid"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // RecordSheet 记录表模型
 type RecordSheet struct {
-	College      string    `json:"college" bson:"college"`               // 学院
-	Name         string    `json:"name" bson:"name"`                     // 姓名
-	StudentID    string    `json:"student_id" bson:"student_id"`         // 学生ID
-	UserType     string    `json:"user_type" bson:"user_type"`           // 用户类型id
-	UserTypeDesc string    `json:"user_type_desc" bson:"user_type_desc"` // 用户类型 text
-	Gender       string    `json:"gender" bson:"gender"`                 // 性别
-	Time         time.Time `json:"time" bson:"time"`                     // 答卷时间
+	College      string             `json:"college" bson:"college"`               // 学院
+	Name         string             `json:"name" bson:"name"`                     // 姓名
+	StudentID    string             `json:"student_id" bson:"student_id"`         // 学生ID
+	UserType     string             `json:"user_type" bson:"user_type"`           // 用户类型id
+	UserTypeDesc string             `json:"user_type_desc" bson:"user_type_desc"` // 用户类型 text
+	Gender       string             `json:"gender" bson:"gender"`                 // 性别
+	Time         time.Time          `json:"time" bson:"time"`                     // 答卷时间
+	AnswerID     primitive.ObjectID `json:"answer_id" bson:"answer_id,omitempty"` // 对应的答卷ID
 }
 
 // SaveRecordSheet 将记录直接保存到 MongoDB 集合中
@@ -25,8 +29,41 @@ func (d *Dao) SaveRecordSheet(ctx context.Context, answerSheet RecordSheet, sid
 	return err
 }
 
+// SaveAnonymousRecordSheet 保存匿名问卷的记录, 使用随机ID以免通过ID中的时间戳与答卷关联
+func (d *Dao) SaveAnonymousRecordSheet(ctx context.Context, answerSheet RecordSheet, sid int) error {
+	_, err := d.mongo.Collection(database.Record).InsertOne(ctx,
+		bson.M{"_id": uuid.NewString(), "survey_id": sid, "record": answerSheet})
+	return err
+}
+
 // DeleteRecordSheets 删除记录表
 func (d *Dao) DeleteRecordSheets(ctx context.Context, surveyID int) error {
 	_, err := d.mongo.Collection(database.Record).DeleteMany(ctx, bson.M{"survey_id": surveyID})
 	return err
 }
+
+// GetRecordSheetsBySurveyID 获取问卷的统一验证记录
+func (d *Dao) GetRecordSheetsBySurveyID(ctx context.Context, surveyID int) ([]RecordSheet, error) {
+	cur, err := d.mongo.Collection(database.Record).Find(ctx, bson.M{"survey_id": surveyID})
+	if err != nil {
+		return nil, err
+	}
+	var docs []struct {
+		Record RecordSheet `bson:"record"`
+	}
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	sheets := make([]RecordSheet, 0, len(docs))
+	for _, doc := range docs {
+		sheets = append(sheets, doc.Record)
+	}
+	return sheets, nil
+}
+
+// HasRecordSheet 判断填写者是否有问卷的统一验证记录
+func (d *Dao) HasRecordSheet(ctx context.Context, surveyID int, stuId string) (bool, error) {
+	filter := bson.M{"survey_id": surveyID, "record.student_id": stuId}
+	count, err := d.mongo.Collection(database.Record).CountDocuments(ctx, filter, options.Count().SetLimit(1))
+	return count > 0, err
+}
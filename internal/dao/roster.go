@@ -0,0 +1,58 @@
+package dao
+
+import (
+	"context"
+
+	"QA-System/internal/model"
+	"gorm.io/gorm"
+)
+
+// ReplaceRosters 在同一事务中用新名单替换问卷的指定类型名单, 失败时保留原名单
+func (d *Dao) ReplaceRosters(ctx context.Context, surveyID int, listType int, rosters []model.Roster) error {
+	return d.orm.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("survey_id = ? AND list_type = ?", surveyID, listType).Delete(&model.Roster{}).Error
+		if err != nil {
+			return err
+		}
+		if len(rosters) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(&rosters, 500).Error
+	})
+}
+
+// GetRostersBySurveyID 根据问卷ID和名单类型获取名单
+func (d *Dao) GetRostersBySurveyID(ctx context.Context, surveyID int, listType int) ([]model.Roster, error) {
+	var rosters []model.Roster
+	err := d.orm.WithContext(ctx).Where("survey_id = ? AND list_type = ?", surveyID, listType).
+		Order("id").Find(&rosters).Error
+	return rosters, err
+}
+
+// GetRostersByStudentID 获取学号在问卷各名单中的记录
+func (d *Dao) GetRostersByStudentID(ctx context.Context, surveyID int, stuId string) ([]model.Roster, error) {
+	var rosters []model.Roster
+	err := d.orm.WithContext(ctx).Where("survey_id = ? AND student_id = ?", surveyID, stuId).Find(&rosters).Error
+	return rosters, err
+}
+
+// CountRosters 统计问卷名单人数
+func (d *Dao) CountRosters(ctx context.Context, surveyID int, listType int) (int64, error) {
+	var count int64
+	err := d.orm.WithContext(ctx).Model(&model.Roster{}).
+		Where("survey_id = ? AND list_type = ?", surveyID, listType).Count(&count).Error
+	return count, err
+}
+
+// DeleteRosters 根据问卷ID和名单类型删除名单
+func (d *Dao) DeleteRosters(ctx context.Context, surveyID int, listType int) error {
+	err := d.orm.WithContext(ctx).Where("survey_id = ? AND list_type = ?", surveyID, listType).
+		Delete(&model.Roster{}).Error
+	return err
+}
+
+// DeleteRostersBySurveyID 根据问卷ID删除全部名单
+func (d *Dao) DeleteRostersBySurveyID(ctx context.Context, surveyID int) error {
+	err := d.orm.WithContext(ctx).Where("survey_id = ?", surveyID).Delete(&model.Roster{}).Error
+	return err
+}
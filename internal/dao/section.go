@@ -0,0 +1,50 @@
+package dao
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"QA-System/internal/model"
+	"QA-System/internal/pkg/redis"
+)
+
+// CreateSection 创建分页
+func (d *Dao) CreateSection(ctx context.Context, section model.Section) (model.Section, error) {
+	err := d.orm.WithContext(ctx).Create(&section).Error
+	return section, err
+}
+
+// GetSectionsBySurveyID 根据问卷ID获取分页列表
+func (d *Dao) GetSectionsBySurveyID(ctx context.Context, surveyID int) ([]model.Section, error) {
+	var sections []model.Section
+	cacheData, err := redis.RedisClient.Get(ctx, fmt.Sprintf("sections:sid:%d", surveyID)).Result()
+	if err == nil && cacheData != "" {
+		// 反序列化 JSON 为结构体
+		if err := json.Unmarshal([]byte(cacheData), &sections); err == nil {
+			return sections, nil
+		}
+	}
+	err = d.orm.WithContext(ctx).Model(model.Section{}).Where("survey_id = ?", surveyID).
+		Order("serial_num").Find(&sections).Error
+	if err != nil {
+		return nil, err
+	}
+	// 序列化为 JSON 后存储到 Redis
+	jsonData, err := json.Marshal(sections)
+	if err == nil {
+		redis.RedisClient.Set(ctx, fmt.Sprintf("sections:sid:%d", surveyID), jsonData, 20*time.Minute)
+	}
+	return sections, nil
+}
+
+// DeleteSectionsBySurveyID 根据问卷ID删除分页
+func (d *Dao) DeleteSectionsBySurveyID(ctx context.Context, surveyID int) error {
+	err := redis.RedisClient.Del(ctx, fmt.Sprintf("sections:sid:%d", surveyID)).Err()
+	if err != nil {
+		return err
+	}
+	err = d.orm.WithContext(ctx).Where("survey_id = ?", surveyID).Delete(&model.Section{}).Error
+	return err
+}
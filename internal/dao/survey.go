@@ -2,10 +2,12 @@ package dao
 
 import (
 	"context"
+	"strings"
 	"time"
 
 	"QA-System/internal/model"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // CreateSurvey 创建问卷
@@ -20,28 +22,56 @@ func (d *Dao) UpdateSurveyStatus(ctx context.Context, surveyID int, status int)
 	return err
 }
 
+// surveyUpdateFields 修改问卷时更新的字段, 显式指定以便布尔值和数值可以被更新为零值
+var surveyUpdateFields = []string{
+	"Title",
+	"Desc",
+	"Type",
+	"StartTime",
+	"Deadline",
+	"DailyLimit",
+	"SumLimit",
+	"Verify",
+	"MaxNum",
+	"Shuffle",
+	"DrawNum",
+	"ShowScore",
+	"AllowEdit",
+	"Anonymous",
+	"AccessCode",
+	"InviteOnly",
+	"ProofOfWork",
+	"IPLimit",
+	"DeviceLimit",
+	"UniqueMode",
+	"ResultVisible",
+	"ResultTopN",
+	"ReceiptAnswers",
+	"EligibleUserTypes",
+	"EligibleColleges",
+	"EligibleGenders",
+	"EligibleStuIDPrefixes",
+}
+
 // UpdateSurvey 更新问卷
-func (d *Dao) UpdateSurvey(ctx context.Context, id int, surveyType, limit uint,
-	sumLimit uint, verify bool, desc string, title string, deadline, startTime time.Time) error {
-	err := d.orm.WithContext(ctx).Model(&model.Survey{}).Where("id = ?", id).
-		Updates(model.Survey{
-			Deadline:   deadline,
-			DailyLimit: limit,
-			SumLimit:   sumLimit,
-			Verify:     verify,
-			Desc:       desc,
-			Title:      title,
-			Type:       surveyType,
-			StartTime:  startTime,
-		}).Error
+func (d *Dao) UpdateSurvey(ctx context.Context, survey model.Survey) error {
+	err := d.orm.WithContext(ctx).Model(&model.Survey{}).Where("id = ?", survey.ID).
+		Select(surveyUpdateFields).Updates(survey).Error
 	return err
 }
 
-// GetSurveyByUserID 获取用户的所有问卷
-func (d *Dao) GetSurveyByUserID(ctx context.Context, userId int) ([]model.Survey, error) {
-	var surveys []model.Survey
-	result := d.orm.WithContext(ctx).Model(model.Survey{}).Where("user_id = ?", userId).Find(&surveys)
-	return surveys, result.Error
+// UpdateSurveyAccessCode 更新问卷访问码
+func (d *Dao) UpdateSurveyAccessCode(ctx context.Context, surveyID int, accessCode string) error {
+	err := d.orm.WithContext(ctx).Model(&model.Survey{}).Where("id = ?", surveyID).
+		Update("access_code", accessCode).Error
+	return err
+}
+
+// GetAnonymousSurveyIDs 获取所有匿名问卷的ID
+func (d *Dao) GetAnonymousSurveyIDs(ctx context.Context) ([]int, error) {
+	var ids []int
+	err := d.orm.WithContext(ctx).Model(&model.Survey{}).Where(&model.Survey{Anonymous: true}).Pluck("id", &ids).Error
+	return ids, err
 }
 
 // GetSurveyByID 根据问卷ID获取问卷
@@ -51,17 +81,26 @@ func (d *Dao) GetSurveyByID(ctx context.Context, surveyID int) (*model.Survey, e
 	return &survey, err
 }
 
-// GetAllSurvey 获取全部问卷
-func (d *Dao) GetAllSurvey(ctx context.Context) ([]model.Survey, error) {
-	var surveys []model.Survey
-	err := d.orm.WithContext(ctx).Model(model.Survey{}).Find(&surveys).Error
-	return surveys, err
+// IncreaseSurveyNum 增加问卷填写人数, 问卷填写数量已达上限时返回 false
+func (d *Dao) IncreaseSurveyNum(ctx context.Context, sid int) (bool, error) {
+	result := d.orm.WithContext(ctx).Model(&model.Survey{}).
+		Where("id = ? AND (max_num = 0 OR num < max_num)", sid).
+		Update("num", gorm.Expr("num + ?", 1))
+	return result.RowsAffected > 0, result.Error
+}
+
+// DecreaseSurveyNum 减少问卷填写人数
+func (d *Dao) DecreaseSurveyNum(ctx context.Context, sid int) error {
+	err := d.orm.WithContext(ctx).Model(&model.Survey{}).Where("id = ? AND num > 0", sid).
+		Update("num", gorm.Expr("num - ?", 1)).Error
+	return err
 }
 
-// IncreaseSurveyNum 增加问卷填写人数
-func (d *Dao) IncreaseSurveyNum(ctx context.Context, sid int) error {
-	err := d.orm.WithContext(ctx).Model(&model.Survey{}).Where("id = ?", sid).
-		Update("num", gorm.Expr("num + ?", 1)).Error
+// CloseFullSurvey 问卷填写数量达到上限时将问卷设为已截止
+func (d *Dao) CloseFullSurvey(ctx context.Context, sid int) error {
+	err := d.orm.WithContext(ctx).Model(&model.Survey{}).
+		Where("id = ? AND status = ? AND max_num > 0 AND num >= max_num", sid, 2).
+		Update("status", 3).Error
 	return err
 }
 
@@ -70,3 +109,118 @@ func (d *Dao) DeleteSurvey(ctx context.Context, surveyID int) error {
 	err := d.orm.WithContext(ctx).Where("id = ?", surveyID).Delete(&model.Survey{}).Error
 	return err
 }
+
+// 问卷列表的排序字段
+const (
+	SurveySortDefault  = ""           // 按已发布、未发布、已截止排序, 同状态按ID降序
+	SurveySortID       = "id"         // 按问卷ID排序
+	SurveySortCreated  = "created_at" // 按创建时间排序
+	SurveySortDeadline = "deadline"   // 按截止时间排序
+	SurveySortNum      = "num"        // 按填写数量排序
+	SurveySortTitle    = "title"      // 按标题排序
+)
+
+// surveyStatusRank 默认排序中问卷状态的先后, 截止时间已过的问卷视为已截止
+const surveyStatusRank = "CASE WHEN deadline < ? THEN 2 WHEN status = 2 THEN 0 WHEN status = 1 THEN 1 ELSE 2 END"
+
+// SurveyFilter 问卷列表的筛选、排序和分页条件
+type SurveyFilter struct {
+	ViewerID     int       // 非0时只查询该用户创建或管理的问卷
+	OwnerID      int       // 创建者ID 0为不限制
+	Status       int       // 问卷状态 0为不限制, 截止时间已过的问卷视为已截止
+	Type         *uint     // 问卷类型 nil为不限制
+	Title        string    // 标题包含的关键字
+	CreatedFrom  time.Time // 创建时间范围, 零值为不限制
+	CreatedTo    time.Time
+	DeadlineFrom time.Time // 截止时间范围, 零值为不限制
+	DeadlineTo   time.Time
+	Sort         string        // 排序字段
+	Desc         bool          // 是否降序, 默认排序时忽略
+	Now          time.Time     // 判断问卷是否已截止的时间
+	After        *SurveyCursor // 键集分页游标, 非空时只返回排在游标之后的问卷
+	Offset       int           // 未使用游标时跳过的问卷数
+	Limit        int
+}
+
+// SurveyCursor 问卷列表的键集分页游标, 记录上一页最后一份问卷的排序值和ID
+type SurveyCursor struct {
+	Value any
+	ID    int
+}
+
+// ListSurveys 按条件分页查询问卷, 同时返回符合筛选条件的问卷总数
+func (d *Dao) ListSurveys(ctx context.Context, filter SurveyFilter) ([]model.Survey, int64, error) {
+	query := d.orm.WithContext(ctx).Model(&model.Survey{})
+	if filter.ViewerID != 0 {
+		managed := d.orm.Model(&model.Manage{}).Select("survey_id").Where("user_id = ?", filter.ViewerID)
+		query = query.Where("(user_id = ? OR id IN (?))", filter.ViewerID, managed)
+	}
+	if filter.OwnerID != 0 {
+		query = query.Where("user_id = ?", filter.OwnerID)
+	}
+	switch filter.Status {
+	case 0:
+	case 3:
+		query = query.Where("(status = 3 OR deadline < ?)", filter.Now)
+	default:
+		query = query.Where("status = ? AND deadline >= ?", filter.Status, filter.Now)
+	}
+	if filter.Type != nil {
+		query = query.Where("type = ?", *filter.Type)
+	}
+	if filter.Title != "" {
+		query = query.Where("title LIKE ?", "%"+escapeLike(filter.Title)+"%")
+	}
+	if !filter.CreatedFrom.IsZero() {
+		query = query.Where("created_at >= ?", filter.CreatedFrom)
+	}
+	if !filter.CreatedTo.IsZero() {
+		query = query.Where("created_at <= ?", filter.CreatedTo)
+	}
+	if !filter.DeadlineFrom.IsZero() {
+		query = query.Where("deadline >= ?", filter.DeadlineFrom)
+	}
+	if !filter.DeadlineTo.IsZero() {
+		query = query.Where("deadline <= ?", filter.DeadlineTo)
+	}
+	query = query.Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	// 排序键为 (排序值, ID), ID 保证顺序唯一, 游标据此定位
+	sortExpr, sortVars := filter.Sort, []any{}
+	desc, idDesc := filter.Desc, filter.Desc
+	if filter.Sort == SurveySortDefault {
+		sortExpr, sortVars = surveyStatusRank, []any{filter.Now}
+		desc, idDesc = false, true
+	}
+	direction, idDirection, op, idOp := "ASC", "ASC", ">", ">"
+	if desc {
+		direction, op = "DESC", "<"
+	}
+	if idDesc {
+		idDirection, idOp = "DESC", "<"
+	}
+	page := query
+	if filter.After != nil {
+		vars := append(append(append([]any{}, sortVars...), filter.After.Value), sortVars...)
+		vars = append(vars, filter.After.Value, filter.After.ID)
+		page = page.Where("(("+sortExpr+" "+op+" ?) OR ("+sortExpr+" = ? AND id "+idOp+" ?))", vars...)
+	} else if filter.Offset > 0 {
+		page = page.Offset(filter.Offset)
+	}
+	var surveys []model.Survey
+	err := page.Clauses(clause.OrderBy{Expression: clause.Expr{
+		SQL:  sortExpr + " " + direction + ", id " + idDirection,
+		Vars: sortVars,
+	}}).Limit(filter.Limit).Find(&surveys).Error
+	return surveys, total, err
+}
+
+// escapeLike 转义 LIKE 模式中的通配符
+func escapeLike(s string) string {
+	return strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(s)
+}
@@ -0,0 +1,80 @@
+package dao
+
+import (
+	"context"
+
+	database "QA-System/internal/pkg/database/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// UniqueAnswer mongodb唯一问题答案表模型, 同一问卷同一问题的答案值唯一
+type UniqueAnswer struct {
+	ID         primitive.ObjectID `bson:"_id"`        // 记录ID
+	SurveyID   int                `bson:"surveyid"`   // 问卷ID
+	QuestionID int                `bson:"questionid"` // 问题ID
+	Value      string             `bson:"value"`      // 规范化后的答案
+	AnswerID   primitive.ObjectID `bson:"answerid"`   // 占用该答案的答卷ID
+}
+
+// InsertUniqueAnswer 占用唯一问题的答案, 答案已被占用时返回重复键错误
+func (d *Dao) InsertUniqueAnswer(ctx context.Context, answer UniqueAnswer) error {
+	_, err := d.mongo.Collection(database.Unique).InsertOne(ctx, answer)
+	return err
+}
+
+// GetUniqueAnswer 获取唯一问题答案的占用记录
+func (d *Dao) GetUniqueAnswer(ctx context.Context, surveyID int, questionID int, value string) (*UniqueAnswer, error) {
+	var answer UniqueAnswer
+	filter := bson.M{"surveyid": surveyID, "questionid": questionID, "value": value}
+	err := d.mongo.Collection(database.Unique).FindOne(ctx, filter).Decode(&answer)
+	return &answer, err
+}
+
+// ReplaceUniqueAnswer 将唯一问题的答案改由新的答卷占用, 返回原占用记录, 原先未被占用时返回 mongo.ErrNoDocuments
+func (d *Dao) ReplaceUniqueAnswer(ctx context.Context, answer UniqueAnswer) (*UniqueAnswer, error) {
+	var previous UniqueAnswer
+	filter := bson.M{"surveyid": answer.SurveyID, "questionid": answer.QuestionID, "value": answer.Value}
+	update := bson.M{
+		"$set":         bson.M{"answerid": answer.AnswerID},
+		"$setOnInsert": bson.M{"_id": answer.ID},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before)
+	err := d.mongo.Collection(database.Unique).FindOneAndUpdate(ctx, filter, update, opts).Decode(&previous)
+	return &previous, err
+}
+
+// RestoreUniqueAnswer 将唯一问题的答案归还给原占用的答卷
+func (d *Dao) RestoreUniqueAnswer(ctx context.Context, id primitive.ObjectID, answerID primitive.ObjectID) error {
+	update := bson.M{"$set": bson.M{"answerid": answerID}}
+	_, err := d.mongo.Collection(database.Unique).UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
+
+// DeleteUniqueAnswers 删除占用记录
+func (d *Dao) DeleteUniqueAnswers(ctx context.Context, ids []primitive.ObjectID) error {
+	_, err := d.mongo.Collection(database.Unique).DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	return err
+}
+
+// DeleteUniqueAnswersByAnswerID 删除答卷占用的答案, 保留 except 中的记录
+func (d *Dao) DeleteUniqueAnswersByAnswerID(ctx context.Context, answerID primitive.ObjectID,
+	except []primitive.ObjectID) error {
+	filter := bson.M{"answerid": answerID, "_id": bson.M{"$nin": except}}
+	_, err := d.mongo.Collection(database.Unique).DeleteMany(ctx, filter)
+	return err
+}
+
+// DeleteUniqueAnswersBySurveyID 删除问卷的所有答案占用记录
+func (d *Dao) DeleteUniqueAnswersBySurveyID(ctx context.Context, surveyID int) error {
+	_, err := d.mongo.Collection(database.Unique).DeleteMany(ctx, bson.M{"surveyid": surveyID})
+	return err
+}
+
+// SetAnswerSheetUnique 设置答卷是否唯一
+func (d *Dao) SetAnswerSheetUnique(ctx context.Context, answerID primitive.ObjectID, unique bool) error {
+	update := bson.M{"$set": bson.M{"unique": unique}}
+	_, err := d.mongo.Collection(database.QA).UpdateOne(ctx, bson.M{"_id": answerID}, update)
+	return err
+}
@@ -0,0 +1,123 @@
+package admin
+
+import (
+	"errors"
+
+	"QA-System/internal/pkg/code"
+	"QA-System/internal/pkg/utils"
+	"QA-System/internal/service"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"gorm.io/gorm"
+)
+
+type getFraudReportData struct {
+	ID          int   `form:"id" binding:"required"`
+	MinDuration int64 `form:"min_duration" binding:"min=0"` // 填写用时少于该秒数视为过快 默认10
+	BurstWindow int64 `form:"burst_window" binding:"min=0"` // 集中提交的时间窗口秒数 默认60
+	BurstSize   int   `form:"burst_size" binding:"min=0"`   // 同一网段在时间窗口内的提交数阈值 默认10
+	PatternSize int   `form:"pattern_size" binding:"min=0"` // 同一网段相同答案数阈值 默认5
+}
+
+// GetFraudReport 获取问卷刷票分析报告
+func GetFraudReport(c *gin.Context) {
+	var data getFraudReportData
+	err := c.ShouldBindQuery(&data)
+	if err != nil {
+		code.AbortWithException(c, code.ParamError, err)
+		return
+	}
+	user, err := service.GetUserSession(c)
+	if err != nil {
+		code.AbortWithException(c, code.NotLogin, err)
+		return
+	}
+	survey, err := service.GetSurveyByID(data.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		code.AbortWithException(c, code.SurveyNotExist, errors.New("问卷不存在"))
+		return
+	} else if err != nil {
+		code.AbortWithException(c, code.ServerError, err)
+		return
+	}
+	// 判断权限
+	if (user.AdminType != 2) && (user.AdminType != 1 || survey.UserID != user.ID) &&
+		!service.UserInManage(user.ID, survey.ID) {
+		code.AbortWithException(c, code.NoPermission, errors.New(user.Username+"无权限"))
+		return
+	}
+	opts := service.FraudOptions{
+		MinDuration: data.MinDuration,
+		BurstWindow: data.BurstWindow,
+		BurstSize:   data.BurstSize,
+		PatternSize: data.PatternSize,
+	}
+	if opts.MinDuration == 0 {
+		opts.MinDuration = 10
+	}
+	if opts.BurstWindow == 0 {
+		opts.BurstWindow = 60
+	}
+	if opts.BurstSize == 0 {
+		opts.BurstSize = 10
+	}
+	if opts.PatternSize == 0 {
+		opts.PatternSize = 5
+	}
+	report, err := service.GetFraudReport(survey.ID, opts)
+	if err != nil {
+		code.AbortWithException(c, code.ServerError, err)
+		return
+	}
+	utils.JsonSuccessResponse(c, report)
+}
+
+type markAnswerSheetsData struct {
+	ID        int      `json:"id" binding:"required"`
+	AnswerIDs []string `json:"answer_ids" binding:"required,min=1"`
+	Invalid   bool     `json:"invalid"` // true 为标记无效, false 为恢复有效
+}
+
+// MarkAnswerSheets 标记或恢复答卷的有效性, 无效答卷不计入统计
+func MarkAnswerSheets(c *gin.Context) {
+	var data markAnswerSheetsData
+	err := c.ShouldBindJSON(&data)
+	if err != nil {
+		code.AbortWithException(c, code.ParamError, err)
+		return
+	}
+	user, err := service.GetUserSession(c)
+	if err != nil {
+		code.AbortWithException(c, code.NotLogin, err)
+		return
+	}
+	survey, err := service.GetSurveyByID(data.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		code.AbortWithException(c, code.SurveyNotExist, errors.New("问卷不存在"))
+		return
+	} else if err != nil {
+		code.AbortWithException(c, code.ServerError, err)
+		return
+	}
+	// 判断权限
+	if (user.AdminType != 2) && (user.AdminType != 1 || survey.UserID != user.ID) &&
+		!service.UserInManage(user.ID, survey.ID) {
+		code.AbortWithException(c, code.NoPermission, errors.New(user.Username+"无权限"))
+		return
+	}
+	answerIDs := make([]primitive.ObjectID, 0, len(data.AnswerIDs))
+	for _, answerID := range data.AnswerIDs {
+		objectID, err := primitive.ObjectIDFromHex(answerID)
+		if err != nil {
+			code.AbortWithException(c, code.ParamError, err)
+			return
+		}
+		answerIDs = append(answerIDs, objectID)
+	}
+	modified, err := service.MarkAnswerSheetsInvalid(survey.ID, answerIDs, data.Invalid)
+	if err != nil {
+		code.AbortWithException(c, code.ServerError, err)
+		return
+	}
+	utils.JsonSuccessResponse(c, gin.H{"modified": modified})
+}
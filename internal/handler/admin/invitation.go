@@ -0,0 +1,163 @@
+package admin
+
+import (
+	"errors"
+	"mime/multipart"
+
+	"QA-System/internal/pkg/code"
+	"QA-System/internal/pkg/utils"
+	"QA-System/internal/service"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type importInvitationsData struct {
+	ID   int                   `form:"id" binding:"required"`
+	File *multipart.FileHeader `form:"file" binding:"required"`
+}
+
+// ImportInvitations 导入受邀人并生成邀请
+func ImportInvitations(c *gin.Context) {
+	var data importInvitationsData
+	err := c.ShouldBind(&data)
+	if err != nil {
+		code.AbortWithException(c, code.ParamError, err)
+		return
+	}
+	user, err := service.GetUserSession(c)
+	if err != nil {
+		code.AbortWithException(c, code.NotLogin, err)
+		return
+	}
+	survey, err := service.GetSurveyByID(data.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		code.AbortWithException(c, code.SurveyNotExist, errors.New("问卷不存在"))
+		return
+	} else if err != nil {
+		code.AbortWithException(c, code.ServerError, err)
+		return
+	}
+	// 判断权限
+	if (user.AdminType != 2) && (user.AdminType != 1 || survey.UserID != user.ID) &&
+		!service.UserInManage(user.ID, survey.ID) {
+		code.AbortWithException(c, code.NoPermission, errors.New(user.Username+"无权限"))
+		return
+	}
+	file, err := data.File.Open()
+	if err != nil {
+		code.AbortWithException(c, code.ServerError, err)
+		return
+	}
+	defer func(file multipart.File) {
+		err := file.Close()
+		if err != nil {
+			zap.L().Error("Failed to close file", zap.Error(err))
+		}
+	}(file)
+	invitations, err := service.ImportInvitations(survey.ID, file, data.File.Filename)
+	if errors.Is(err, code.RosterFileError) {
+		code.AbortWithException(c, code.RosterFileError, err)
+		return
+	} else if err != nil {
+		code.AbortWithException(c, code.ServerError, err)
+		return
+	}
+	utils.JsonSuccessResponse(c, gin.H{"invitations": invitations})
+}
+
+type getInvitationsData struct {
+	ID     int `form:"id" binding:"required"`
+	Status int `form:"status" binding:"omitempty,oneof=1 2 3"` // 邀请状态 1:未使用 2:已使用 3:已撤销 不填为全部
+}
+
+// GetInvitations 获取问卷的邀请使用情况
+func GetInvitations(c *gin.Context) {
+	var data getInvitationsData
+	err := c.ShouldBindQuery(&data)
+	if err != nil {
+		code.AbortWithException(c, code.ParamError, err)
+		return
+	}
+	user, err := service.GetUserSession(c)
+	if err != nil {
+		code.AbortWithException(c, code.NotLogin, err)
+		return
+	}
+	survey, err := service.GetSurveyByID(data.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		code.AbortWithException(c, code.SurveyNotExist, errors.New("问卷不存在"))
+		return
+	} else if err != nil {
+		code.AbortWithException(c, code.ServerError, err)
+		return
+	}
+	// 判断权限
+	if (user.AdminType != 2) && (user.AdminType != 1 || survey.UserID != user.ID) &&
+		!service.UserInManage(user.ID, survey.ID) {
+		code.AbortWithException(c, code.NoPermission, errors.New(user.Username+"无权限"))
+		return
+	}
+	invitations, err := service.GetInvitations(survey.ID, data.Status)
+	if err != nil {
+		code.AbortWithException(c, code.ServerError, err)
+		return
+	}
+	counts := make(map[int]int, 3)
+	for _, invitation := range invitations {
+		counts[invitation.Status]++
+	}
+	utils.JsonSuccessResponse(c, gin.H{
+		"invitations": invitations,
+		"unused":      counts[1],
+		"used":        counts[2],
+		"revoked":     counts[3],
+	})
+}
+
+type revokeInvitationData struct {
+	ID int `json:"id" binding:"required"` // 邀请ID
+}
+
+// RevokeInvitation 撤销未使用的邀请
+func RevokeInvitation(c *gin.Context) {
+	var data revokeInvitationData
+	err := c.ShouldBindJSON(&data)
+	if err != nil {
+		code.AbortWithException(c, code.ParamError, err)
+		return
+	}
+	user, err := service.GetUserSession(c)
+	if err != nil {
+		code.AbortWithException(c, code.NotLogin, err)
+		return
+	}
+	invitation, err := service.GetInvitationByID(data.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		code.AbortWithException(c, code.InvitationInvalidError, errors.New("邀请不存在"))
+		return
+	} else if err != nil {
+		code.AbortWithException(c, code.ServerError, err)
+		return
+	}
+	survey, err := service.GetSurveyByID(invitation.SurveyID)
+	if err != nil {
+		code.AbortWithException(c, code.ServerError, err)
+		return
+	}
+	// 判断权限
+	if (user.AdminType != 2) && (user.AdminType != 1 || survey.UserID != user.ID) &&
+		!service.UserInManage(user.ID, survey.ID) {
+		code.AbortWithException(c, code.NoPermission, errors.New(user.Username+"无权限"))
+		return
+	}
+	err = service.RevokeInvitation(invitation.ID)
+	if errors.Is(err, code.InvitationUsedError) {
+		code.AbortWithException(c, code.InvitationUsedError, errors.New("邀请已被使用或撤销"))
+		return
+	} else if err != nil {
+		code.AbortWithException(c, code.ServerError, err)
+		return
+	}
+	utils.JsonSuccessResponse(c, nil)
+}
@@ -21,9 +21,9 @@ import (
 
 type createSurveyData struct {
 	Status         int                `json:"status" binding:"required,oneof=1 2"`
-	SurveyType     uint               `json:"survey_type"` // 问卷类型 0:调研 1:投票
-	BaseConfig     dao.BaseConfig     `json:"base_config"` // 基本配置
-	QuestionConfig dao.QuestionConfig `json:"ques_config"` // 问题设置
+	SurveyType     uint               `json:"survey_type" binding:"oneof=0 1 2"` // 问卷类型 0:调研 1:投票 2:测验
+	BaseConfig     dao.BaseConfig     `json:"base_config"`                       // 基本配置
+	QuestionConfig dao.QuestionConfig `json:"ques_config"`                       // 问题设置
 }
 
 // CreateSurvey 创建问卷
@@ -61,13 +61,14 @@ func CreateSurvey(c *gin.Context) {
 		code.AbortWithException(c, code.SurveyError, errors.New("总投票次数小于单日投票次数"))
 		return
 	}
+	// 检查匿名问卷设置
+	if err := checkAnonymity(data.BaseConfig); err != nil {
+		code.AbortWithException(c, code.SurveyError, err)
+		return
+	}
 	// 检查问卷每个题目的序号没有重复且按照顺序递增
 	questionNumMap := make(map[int]bool)
 	for i, question := range data.QuestionConfig.QuestionList {
-		if data.SurveyType == 2 && (question.QuestionSetting.QuestionType != 2 && !question.QuestionSetting.Required) {
-			code.AbortWithException(c, code.SurveyError, errors.New("投票题目只能为多选必填题"))
-			return
-		}
 		if questionNumMap[question.SerialNum] {
 			code.AbortWithException(c, code.SurveyError, errors.New("题目序号"+strconv.Itoa(question.SerialNum)+"重复"))
 			return
@@ -80,26 +81,43 @@ func CreateSurvey(c *gin.Context) {
 		question.SerialNum = i + 1
 
 		// 检测多选题目的最多选项数和最少选项数
-		if ((question.QuestionSetting.QuestionType == 2 && data.SurveyType == 0) ||
+		if ((question.QuestionSetting.QuestionType == 2 && data.SurveyType != 1) ||
 			(question.QuestionSetting.QuestionType == 1 && data.SurveyType == 1)) &&
 			(question.QuestionSetting.MaximumOption < question.QuestionSetting.MinimumOption) {
 			code.AbortWithException(c, code.OptionNumError, errors.New("多选最多选项数小于最少选项数"))
 			return
 		}
 		// 检查多选选项和最少选项数是否符合要求
-		if ((question.QuestionSetting.QuestionType == 2 && data.SurveyType == 0) ||
+		if ((question.QuestionSetting.QuestionType == 2 && data.SurveyType != 1) ||
 			(question.QuestionSetting.QuestionType == 1 && data.SurveyType == 1)) &&
 			uint(len(question.Options)) < question.QuestionSetting.MinimumOption {
 			code.AbortWithException(c, code.OptionNumError, errors.New("选项数量小于最少选项数"))
 			return
 		}
 		// 检查最多选项数是否符合要求
-		if ((question.QuestionSetting.QuestionType == 2 && data.SurveyType == 0) ||
+		if ((question.QuestionSetting.QuestionType == 2 && data.SurveyType != 1) ||
 			(question.QuestionSetting.QuestionType == 1 && data.SurveyType == 1)) &&
 			question.QuestionSetting.MaximumOption == 0 {
 			code.AbortWithException(c, code.OptionNumError, errors.New("最多选项数小于等于0"))
 			return
 		}
+		// 检查测验题目的正确答案是否为已有选项
+		if data.SurveyType == 2 {
+			if err := checkCorrectAnswer(question); err != nil {
+				code.AbortWithException(c, code.SurveyError, err)
+				return
+			}
+		}
+	}
+	// 检查分页设置
+	if err := checkSections(data.QuestionConfig); err != nil {
+		code.AbortWithException(c, code.SurveyError, err)
+		return
+	}
+	// 检查题库题目数量是否满足抽题数量
+	if data.BaseConfig.DrawNum > 0 && countBankQuestions(data.QuestionConfig.QuestionList) < data.BaseConfig.DrawNum {
+		code.AbortWithException(c, code.SurveyError, errors.New("题库题目数量少于抽题数量"))
+		return
 	}
 	// 检测问卷是否填写完整
 	if data.Status == 2 {
@@ -109,6 +127,10 @@ func CreateSurvey(c *gin.Context) {
 		}
 		questionMap := make(map[string]bool)
 		for _, question := range data.QuestionConfig.QuestionList {
+			// 展示块无需作答, 不检查标题
+			if question.QuestionSetting.QuestionType == 7 {
+				continue
+			}
 			if question.Subject == "" {
 				code.AbortWithException(c, code.SurveyIncomplete,
 					errors.New("问题"+strconv.Itoa(question.SerialNum)+"标题为空"))
@@ -144,9 +166,8 @@ func CreateSurvey(c *gin.Context) {
 		}
 	}
 	// 创建问卷
-	err = service.CreateSurvey(user.ID, data.QuestionConfig.QuestionList, data.Status, data.SurveyType, data.BaseConfig.
-		DailyLimit, data.BaseConfig.SumLimit, data.BaseConfig.Verify, ddlTime, startTime, data.QuestionConfig.Title,
-		data.QuestionConfig.Desc)
+	err = service.CreateSurvey(user.ID, data.QuestionConfig.Sections, data.QuestionConfig.QuestionList, data.Status,
+		data.SurveyType, data.BaseConfig, ddlTime, startTime, data.QuestionConfig.Title, data.QuestionConfig.Desc)
 	if err != nil {
 		code.AbortWithException(c, code.ServerError, err)
 		return
@@ -190,6 +211,11 @@ func UpdateSurveyStatus(c *gin.Context) {
 		code.AbortWithException(c, code.StatusRepeatError, errors.New("问卷状态重复"))
 		return
 	}
+	// 填写数量已达上限的问卷不能重新发布
+	if data.Status == 2 && survey.IsFull() {
+		code.AbortWithException(c, code.SurveyFullError, errors.New("问卷填写数量已达上限"))
+		return
+	}
 	// 检测问卷是否填写完整
 	if data.Status == 2 {
 		if survey.Title == "" {
@@ -206,6 +232,10 @@ func UpdateSurveyStatus(c *gin.Context) {
 		}
 		questionMap := make(map[string]bool)
 		for _, question := range questions {
+			// 展示块无需作答, 不检查标题
+			if question.QuestionType == 7 {
+				continue
+			}
 			if question.Subject == "" {
 				code.AbortWithException(c, code.SurveyIncomplete,
 					errors.New("问题"+strconv.Itoa(question.SerialNum)+"内容填写为空"))
@@ -256,9 +286,9 @@ func UpdateSurveyStatus(c *gin.Context) {
 
 type updateSurveyData struct {
 	ID             int                `json:"id" binding:"required"`
-	SurveyType     uint               `json:"survey_type"` // 问卷类型 0:调研 1:投票
-	BaseConfig     dao.BaseConfig     `json:"base_config"` // 基本配置
-	QuestionConfig dao.QuestionConfig `json:"ques_config"` // 问题设置
+	SurveyType     uint               `json:"survey_type" binding:"oneof=0 1 2"` // 问卷类型 0:调研 1:投票 2:测验
+	BaseConfig     dao.BaseConfig     `json:"base_config"`                       // 基本配置
+	QuestionConfig dao.QuestionConfig `json:"ques_config"`                       // 问题设置
 }
 
 // UpdateSurvey 修改问卷
@@ -319,6 +349,11 @@ func UpdateSurvey(c *gin.Context) {
 		code.AbortWithException(c, code.SurveyError, errors.New("总投票次数小于单日投票次数"))
 		return
 	}
+	// 检查匿名问卷设置
+	if err := checkAnonymity(data.BaseConfig); err != nil {
+		code.AbortWithException(c, code.SurveyError, err)
+		return
+	}
 	// 检查问卷每个题目的序号没有重复且按照顺序递增
 	questionNumMap := make(map[int]bool)
 	for i, question := range data.QuestionConfig.QuestionList {
@@ -332,33 +367,54 @@ func UpdateSurvey(c *gin.Context) {
 		}
 		questionNumMap[question.SerialNum] = true
 		question.SerialNum = i + 1
+		// 修改后问题ID会重新生成, 已有答卷无法按新问题校验唯一性
+		if survey.Num != 0 && question.QuestionSetting.QuestionType == 3 && question.QuestionSetting.Unique {
+			code.AbortWithException(c, code.SurveyNumError, errors.New("问卷已有填写数量，不能设置唯一问题"))
+			return
+		}
 
 		// 检测多选题目的最多选项数和最少选项数
-		if ((question.QuestionSetting.QuestionType == 2 && data.SurveyType == 0) ||
+		if ((question.QuestionSetting.QuestionType == 2 && data.SurveyType != 1) ||
 			(question.QuestionSetting.QuestionType == 1 && data.SurveyType == 1)) &&
 			(question.QuestionSetting.MaximumOption < question.QuestionSetting.MinimumOption) {
 			code.AbortWithException(c, code.OptionNumError, errors.New("多选最多选项数小于最少选项数"))
 			return
 		}
 		// 检查多选选项和最少选项数是否符合要求
-		if ((question.QuestionSetting.QuestionType == 2 && data.SurveyType == 0) ||
+		if ((question.QuestionSetting.QuestionType == 2 && data.SurveyType != 1) ||
 			(question.QuestionSetting.QuestionType == 1 && data.SurveyType == 1)) &&
 			uint(len(question.Options)) < question.QuestionSetting.MinimumOption {
 			code.AbortWithException(c, code.OptionNumError, errors.New("选项数量小于最少选项数"))
 			return
 		}
 		// 检查最多选项数是否符合要求
-		if ((question.QuestionSetting.QuestionType == 2 && data.SurveyType == 0) ||
+		if ((question.QuestionSetting.QuestionType == 2 && data.SurveyType != 1) ||
 			(question.QuestionSetting.QuestionType == 1 && data.SurveyType == 1)) &&
 			question.QuestionSetting.MaximumOption == 0 {
 			code.AbortWithException(c, code.OptionNumError, errors.New("最多选项数小于等于0"))
 			return
 		}
+		// 检查测验题目的正确答案是否为已有选项
+		if data.SurveyType == 2 {
+			if err := checkCorrectAnswer(question); err != nil {
+				code.AbortWithException(c, code.SurveyError, err)
+				return
+			}
+		}
+	}
+	// 检查分页设置
+	if err := checkSections(data.QuestionConfig); err != nil {
+		code.AbortWithException(c, code.SurveyError, err)
+		return
+	}
+	// 检查题库题目数量是否满足抽题数量
+	if data.BaseConfig.DrawNum > 0 && countBankQuestions(data.QuestionConfig.QuestionList) < data.BaseConfig.DrawNum {
+		code.AbortWithException(c, code.SurveyError, errors.New("题库题目数量少于抽题数量"))
+		return
 	}
 	// 修改问卷
-	err = service.UpdateSurvey(data.ID, data.QuestionConfig.QuestionList, data.SurveyType, data.BaseConfig.DailyLimit,
-		data.BaseConfig.SumLimit, data.BaseConfig.Verify, data.QuestionConfig.Desc, data.QuestionConfig.Title, ddlTime,
-		startTime)
+	err = service.UpdateSurvey(data.ID, data.QuestionConfig.Sections, data.QuestionConfig.QuestionList, data.SurveyType,
+		data.BaseConfig, data.QuestionConfig.Desc, data.QuestionConfig.Title, ddlTime, startTime)
 	if err != nil {
 		code.AbortWithException(c, code.ServerError, err)
 		return
@@ -413,12 +469,43 @@ func DeleteSurvey(c *gin.Context) {
 	utils.JsonSuccessResponse(c, nil)
 }
 
+// answerFilterData 答卷筛选参数, 答卷列表、导出和统计共用
+type answerFilterData struct {
+	Text      string    `form:"text"`
+	From      time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"` // 提交时间范围
+	To        time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+	Questions []string  `form:"question"` // 指定问题的答案条件, 格式为 问题ID:匹配方式:值, 匹配方式为 eq、contains 或 option
+}
+
+// answerFilter 将筛选参数转换为答卷筛选条件
+func (data answerFilterData) answerFilter() (dao.AnswerFilter, error) {
+	filter := dao.AnswerFilter{Text: data.Text, From: data.From, To: data.To}
+	for _, question := range data.Questions {
+		parts := strings.SplitN(question, ":", 3)
+		if len(parts) != 3 {
+			return filter, errors.New("答案条件格式错误: " + question)
+		}
+		qid, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return filter, errors.New("答案条件格式错误: " + question)
+		}
+		switch parts[1] {
+		case dao.MatchEqual, dao.MatchContains, dao.MatchOption:
+		default:
+			return filter, errors.New("不支持的匹配方式: " + parts[1])
+		}
+		filter.Questions = append(filter.Questions, dao.QuestionFilter{QuestionID: qid, Match: parts[1], Value: parts[2]})
+	}
+	return filter, nil
+}
+
 type getSurveyAnswersData struct {
 	ID       int    `form:"id" binding:"required"`
-	Text     string `form:"text"`
 	Unique   bool   `form:"unique"`
-	PageNum  int    `form:"page_num" binding:"required"`
-	PageSize int    `form:"page_size" binding:"required"`
+	PageNum  int    `form:"page_num" binding:"min=0"` // 页码, 传入游标时忽略
+	PageSize int    `form:"page_size" binding:"required,min=1"`
+	Cursor   string `form:"cursor"` // 上一页返回的 next_cursor
+	answerFilterData
 }
 
 // GetSurveyAnswers 获取问卷收集数据
@@ -429,6 +516,11 @@ func GetSurveyAnswers(c *gin.Context) {
 		code.AbortWithException(c, code.ParamError, err)
 		return
 	}
+	filter, err := data.answerFilter()
+	if err != nil {
+		code.AbortWithException(c, code.ParamError, err)
+		return
+	}
 	// 鉴权
 	user, err := service.GetUserSession(c)
 	if err != nil {
@@ -451,28 +543,43 @@ func GetSurveyAnswers(c *gin.Context) {
 		return
 	}
 	// 获取问卷收集数据
-	var num *int64
-	answers, num, err := service.GetSurveyAnswers(data.ID, data.PageNum, data.PageSize, data.Text, data.Unique)
-	if err != nil {
-		if err.Error() == "页数超出范围" {
-			code.AbortWithException(c, code.PageBeyondError, err)
-		} else {
-			code.AbortWithException(c, code.ServerError, err)
-		}
+	page := dao.AnswerPage{Limit: int64(data.PageSize)}
+	if data.PageNum > 1 {
+		page.Skip = int64((data.PageNum - 1) * data.PageSize)
+	}
+	filter.Unique = data.Unique
+	answers, total, nextCursor, err := service.GetSurveyAnswers(data.ID, filter, page, data.Cursor)
+	if errors.Is(err, code.CursorError) {
+		code.AbortWithException(c, code.CursorError, err)
+		return
+	} else if err != nil {
+		code.AbortWithException(c, code.ServerError, err)
 		return
 	}
 
 	utils.JsonSuccessResponse(c, gin.H{
 		"answers_data":   answers,
 		"survey_type":    survey.Type,
-		"total_page_num": math.Ceil(float64(*num) / float64(data.PageSize)),
+		"total":          total,
+		"total_page_num": math.Ceil(float64(total) / float64(data.PageSize)),
+		"next_cursor":    nextCursor,
 	})
 }
 
 type getAllSurveyData struct {
-	PageNum  int    `form:"page_num" binding:"required"`
-	PageSize int    `form:"page_size" binding:"required"`
-	Title    string `form:"title"`
+	PageNum      int       `form:"page_num" binding:"min=0"` // 页码, 传入游标时忽略
+	PageSize     int       `form:"page_size" binding:"required,min=1"`
+	Cursor       string    `form:"cursor"` // 上一页返回的 next_cursor
+	Title        string    `form:"title"`
+	Status       int       `form:"status" binding:"oneof=0 1 2 3"`       // 0为不限制
+	Type         *uint     `form:"type" binding:"omitempty,oneof=0 1 2"` // 不传为不限制
+	OwnerID      int       `form:"owner_id" binding:"min=0"`             // 创建者ID
+	CreatedFrom  time.Time `form:"created_from" time_format:"2006-01-02T15:04:05Z07:00"`
+	CreatedTo    time.Time `form:"created_to" time_format:"2006-01-02T15:04:05Z07:00"`
+	DeadlineFrom time.Time `form:"deadline_from" time_format:"2006-01-02T15:04:05Z07:00"`
+	DeadlineTo   time.Time `form:"deadline_to" time_format:"2006-01-02T15:04:05Z07:00"`
+	Sort         string    `form:"sort" binding:"omitempty,oneof=id created_at deadline num title"` // 不传为按状态排序
+	Order        string    `form:"order" binding:"omitempty,oneof=asc desc"`
 }
 
 // GetAllSurvey 获取所有问卷
@@ -488,41 +595,40 @@ func GetAllSurvey(c *gin.Context) {
 		code.AbortWithException(c, code.NotLogin, err)
 		return
 	}
-	// 获取问卷
-	var surveys []model.Survey
-	if user.AdminType == 2 {
-		surveys, err = service.GetAllSurvey()
-		if err != nil {
-			code.AbortWithException(c, code.ServerError, err)
-			return
-		}
-	} else {
-		surveys, err = service.GetSurveyByUserID(user.ID)
-		if err != nil {
-			code.AbortWithException(c, code.ServerError, err)
-			return
-		}
-		managedSurveys, err := service.GetManagedSurveyByUserID(user.ID)
-		if err != nil {
-			code.AbortWithException(c, code.ServerError, err)
-			return
-		}
-		for _, manage := range managedSurveys {
-			managedSurvey, err := service.GetSurveyByID(manage.SurveyID)
-			if err != nil {
-				code.AbortWithException(c, code.ServerError, err)
-				return
-			}
-			surveys = append(surveys, *managedSurvey)
-		}
+	filter := dao.SurveyFilter{
+		OwnerID:      data.OwnerID,
+		Status:       data.Status,
+		Type:         data.Type,
+		Title:        data.Title,
+		CreatedFrom:  data.CreatedFrom,
+		CreatedTo:    data.CreatedTo,
+		DeadlineFrom: data.DeadlineFrom,
+		DeadlineTo:   data.DeadlineTo,
+		Sort:         data.Sort,
+		Desc:         data.Order == "desc",
+		Limit:        data.PageSize,
+	}
+	// 非超级管理员只能查看自己创建或管理的问卷
+	if user.AdminType != 2 {
+		filter.ViewerID = user.ID
+	}
+	if data.PageNum > 1 {
+		filter.Offset = (data.PageNum - 1) * data.PageSize
+	}
+	response, total, nextCursor, err := service.ListSurveys(filter, data.Cursor)
+	if errors.Is(err, code.CursorError) {
+		code.AbortWithException(c, code.CursorError, err)
+		return
+	} else if err != nil {
+		code.AbortWithException(c, code.ServerError, err)
+		return
 	}
-	surveys = service.SortSurvey(surveys)
-	response := service.GetSurveyResponse(surveys)
-	response, totalPageNum := service.ProcessResponse(response, data.PageNum, data.PageSize, data.Title)
 
 	utils.JsonSuccessResponse(c, gin.H{
 		"survey_list":    response,
-		"total_page_num": math.Ceil(float64(totalPageNum) / float64(data.PageSize)),
+		"total":          total,
+		"total_page_num": math.Ceil(float64(total) / float64(data.PageSize)),
+		"next_cursor":    nextCursor,
 	})
 }
 
@@ -561,6 +667,22 @@ func GetSurvey(c *gin.Context) {
 		code.AbortWithException(c, code.ServerError, err)
 		return
 	}
+	sections, err := service.GetSectionsBySurveyID(survey.ID)
+	if err != nil {
+		code.AbortWithException(c, code.ServerError, err)
+		return
+	}
+	sectionNums := make(map[int]int, len(sections))
+	sectionsResponse := make([]map[string]any, 0, len(sections))
+	for _, section := range sections {
+		sectionNums[section.ID] = section.SerialNum
+		sectionsResponse = append(sectionsResponse, map[string]any{
+			"serial_num":  section.SerialNum,
+			"title":       section.Title,
+			"description": section.Description,
+			"img":         section.Img,
+		})
+	}
 	// 构建问卷响应
 	questionListsResponse := make([]map[string]any, 0)
 	for _, question := range questions {
@@ -577,6 +699,7 @@ func GetSurvey(c *gin.Context) {
 				"content":     option.Content,
 				"img":         option.Img,
 				"description": option.Description,
+				"pinned":      option.Pinned,
 			}
 			optionsResponse = append(optionsResponse, optionResponse)
 		}
@@ -589,11 +712,17 @@ func GetSurvey(c *gin.Context) {
 			"reg":            question.Reg,
 			"maximum_option": question.MaximumOption,
 			"minimum_option": question.MinimumOption,
+			"shuffle":        question.Shuffle,
+			"in_bank":        question.InBank,
+			"correct_answer": question.CorrectAnswer,
+			"points":         question.Points,
+			"explanation":    question.Explanation,
 		}
 
 		questionListMap := map[string]any{
 			"id":           question.ID,
 			"serial_num":   question.SerialNum,
+			"section_num":  sectionNums[question.SectionID],
 			"subject":      question.Subject,
 			"description":  question.Description,
 			"img":          question.Img,
@@ -606,14 +735,31 @@ func GetSurvey(c *gin.Context) {
 	questionsConfigResponse := map[string]any{
 		"title":         survey.Title,
 		"desc":          survey.Desc,
+		"sections":      sectionsResponse,
 		"question_list": questionListsResponse,
 	}
 	baseConfigResponse := map[string]any{
-		"start_time": survey.StartTime,
-		"end_time":   survey.Deadline,
-		"day_limit":  survey.DailyLimit,
-		"sum_limit":  survey.SumLimit,
-		"verify":     survey.Verify,
+		"start_time":      survey.StartTime,
+		"end_time":        survey.Deadline,
+		"day_limit":       survey.DailyLimit,
+		"sum_limit":       survey.SumLimit,
+		"verify":          survey.Verify,
+		"max_num":         survey.MaxNum,
+		"shuffle":         survey.Shuffle,
+		"draw_num":        survey.DrawNum,
+		"show_score":      survey.ShowScore,
+		"allow_edit":      survey.AllowEdit,
+		"anonymous":       survey.Anonymous,
+		"access_code":     survey.AccessCode,
+		"invite_only":     survey.InviteOnly,
+		"proof_of_work":   survey.ProofOfWork,
+		"ip_limit":        survey.IPLimit,
+		"device_limit":    survey.DeviceLimit,
+		"unique_mode":     survey.UniqueMode,
+		"result_visible":  survey.ResultVisible,
+		"result_top_n":    survey.ResultTopN,
+		"receipt_answers": survey.ReceiptAnswers,
+		"eligibility":     service.GetEligibility(survey),
 	}
 	response := map[string]any{
 		"id":          survey.ID,
@@ -627,7 +773,9 @@ func GetSurvey(c *gin.Context) {
 }
 
 type downloadFileData struct {
-	ID int `form:"id" binding:"required"`
+	ID      int    `form:"id" binding:"required"`
+	GroupBy string `form:"group_by" binding:"omitempty,oneof=college gender user_type"` // 分组依据
+	answerFilterData
 }
 
 // DownloadFile 下载
@@ -638,6 +786,11 @@ func DownloadFile(c *gin.Context) {
 		code.AbortWithException(c, code.ParamError, err)
 		return
 	}
+	filter, err := data.answerFilter()
+	if err != nil {
+		code.AbortWithException(c, code.ParamError, err)
+		return
+	}
 	user, err := service.GetUserSession(c)
 	if err != nil {
 		code.AbortWithException(c, code.NotLogin, err)
@@ -656,12 +809,35 @@ func DownloadFile(c *gin.Context) {
 		return
 	}
 	// 获取数据
-	answers, err := service.GetAllSurveyAnswers(data.ID)
+	answers, err := service.GetAllSurveyAnswers(data.ID, filter)
 	if err != nil {
 		code.AbortWithException(c, code.ServerError, err)
 		return
 	}
-	url, err := service.HandleDownloadFile(answers, survey)
+	// 按统一验证信息分组统计, 匿名问卷的答卷无法与身份关联
+	if data.GroupBy != "" && survey.Anonymous {
+		code.AbortWithException(c, code.AnonymousSurveyError, errors.New("匿名问卷不支持分组统计"))
+		return
+	}
+	var groups []service.GroupStatistics
+	if data.GroupBy != "" {
+		answerSheets, err := service.GetSurveyAnswersBySurveyID(data.ID, filter)
+		if err != nil {
+			code.AbortWithException(c, code.ServerError, err)
+			return
+		}
+		questions, err := service.GetQuestionsBySurveyID(data.ID)
+		if err != nil {
+			code.AbortWithException(c, code.ServerError, err)
+			return
+		}
+		groups, err = service.GetGroupStatistics(survey.ID, answerSheets, questions, data.GroupBy)
+		if err != nil {
+			code.AbortWithException(c, code.ServerError, err)
+			return
+		}
+	}
+	url, err := service.HandleDownloadFile(answers, survey, groups)
 	if err != nil {
 		code.AbortWithException(c, code.ServerError, err)
 		return
@@ -670,9 +846,11 @@ func DownloadFile(c *gin.Context) {
 }
 
 type getSurveyStatisticsData struct {
-	ID       int `form:"id" binding:"required"`
-	PageNum  int `form:"page_num" binding:"required"`
-	PageSize int `form:"page_size" binding:"required"`
+	ID       int    `form:"id" binding:"required"`
+	PageNum  int    `form:"page_num" binding:"required"`
+	PageSize int    `form:"page_size" binding:"required"`
+	GroupBy  string `form:"group_by" binding:"omitempty,oneof=college gender user_type"` // 分组依据
+	answerFilterData
 }
 
 type getOptionCount struct {
@@ -695,6 +873,11 @@ func GetSurveyStatistics(c *gin.Context) {
 		code.AbortWithException(c, code.ParamError, err)
 		return
 	}
+	filter, err := data.answerFilter()
+	if err != nil {
+		code.AbortWithException(c, code.ParamError, err)
+		return
+	}
 
 	user, err := service.GetUserSession(c)
 	if err != nil {
@@ -714,7 +897,7 @@ func GetSurveyStatistics(c *gin.Context) {
 		return
 	}
 
-	answersheets, err := service.GetSurveyAnswersBySurveyID(data.ID)
+	answersheets, err := service.GetSurveyAnswersBySurveyID(data.ID, filter)
 	if err != nil {
 		code.AbortWithException(c, code.ServerError, err)
 		return
@@ -840,12 +1023,131 @@ func GetSurveyStatistics(c *gin.Context) {
 	resp := response[start:end]
 	totalSumPage := math.Ceil(float64(len(response)) / float64(data.PageSize))
 
-	utils.JsonSuccessResponse(c, gin.H{
+	result := gin.H{
 		"statistics":     resp,
 		"total":          len(answersheets),
 		"total_sum_page": totalSumPage,
 		"survey_type":    survey.Type,
-	})
+	}
+	// 按统一验证信息分组统计, 匿名问卷的答卷无法与身份关联
+	if data.GroupBy != "" && survey.Anonymous {
+		code.AbortWithException(c, code.AnonymousSurveyError, errors.New("匿名问卷不支持分组统计"))
+		return
+	}
+	if data.GroupBy != "" {
+		groups, err := service.GetGroupStatistics(survey.ID, answersheets, questions, data.GroupBy)
+		if err != nil {
+			code.AbortWithException(c, code.ServerError, err)
+			return
+		}
+		result["groups"] = groups
+	}
+	utils.JsonSuccessResponse(c, result)
+}
+
+type getQuizStatisticsData struct {
+	ID int `form:"id" binding:"required"`
+	answerFilterData
+}
+
+// GetQuizStatistics 获取测验分数分布和各题正确率
+func GetQuizStatistics(c *gin.Context) {
+	var data getQuizStatisticsData
+	if err := c.ShouldBindQuery(&data); err != nil {
+		code.AbortWithException(c, code.ParamError, err)
+		return
+	}
+	filter, err := data.answerFilter()
+	if err != nil {
+		code.AbortWithException(c, code.ParamError, err)
+		return
+	}
+
+	user, err := service.GetUserSession(c)
+	if err != nil {
+		code.AbortWithException(c, code.NotLogin, err)
+		return
+	}
+
+	survey, err := service.GetSurveyByID(data.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		code.AbortWithException(c, code.SurveyNotExist, errors.New("问卷不存在"))
+		return
+	} else if err != nil {
+		code.AbortWithException(c, code.ServerError, err)
+		return
+	}
+
+	if (user.AdminType != 2) && (user.AdminType != 1 || survey.UserID != user.ID) &&
+		!service.UserInManage(user.ID, survey.ID) {
+		code.AbortWithException(c, code.NoPermission, errors.New(user.Username+"无权限"))
+		return
+	}
+
+	if survey.Type != 2 {
+		code.AbortWithException(c, code.SurveyTypeError, errors.New("问卷不是测验"))
+		return
+	}
+
+	answerSheets, err := service.GetSurveyAnswersBySurveyID(data.ID, filter)
+	if err != nil {
+		code.AbortWithException(c, code.ServerError, err)
+		return
+	}
+
+	questions, err := service.GetQuestionsBySurveyID(data.ID)
+	if err != nil {
+		code.AbortWithException(c, code.ServerError, err)
+		return
+	}
+
+	utils.JsonSuccessResponse(c, service.GetQuizStatistics(answerSheets, questions))
+}
+
+type rebuildVoteCountsData struct {
+	ID int `json:"id" binding:"required"`
+}
+
+// RebuildVoteCounts 从答卷重建投票问卷的实时计数, 用于修复计数偏差
+func RebuildVoteCounts(c *gin.Context) {
+	var data rebuildVoteCountsData
+	if err := c.ShouldBindJSON(&data); err != nil {
+		code.AbortWithException(c, code.ParamError, err)
+		return
+	}
+
+	user, err := service.GetUserSession(c)
+	if err != nil {
+		code.AbortWithException(c, code.NotLogin, err)
+		return
+	}
+
+	survey, err := service.GetSurveyByID(data.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		code.AbortWithException(c, code.SurveyNotExist, errors.New("问卷不存在"))
+		return
+	} else if err != nil {
+		code.AbortWithException(c, code.ServerError, err)
+		return
+	}
+
+	if (user.AdminType != 2) && (user.AdminType != 1 || survey.UserID != user.ID) &&
+		!service.UserInManage(user.ID, survey.ID) {
+		code.AbortWithException(c, code.NoPermission, errors.New(user.Username+"无权限"))
+		return
+	}
+
+	if survey.Type != 1 {
+		code.AbortWithException(c, code.SurveyTypeError, errors.New("问卷不是投票"))
+		return
+	}
+
+	counts, err := service.RebuildVoteCounts(survey.ID)
+	if err != nil {
+		code.AbortWithException(c, code.ServerError, err)
+		return
+	}
+	utils.JsonSuccessResponse(c, gin.H{"counts": counts})
 }
 
 type getQuestionPreData struct {
@@ -915,6 +1217,71 @@ func CreateQuestionPre(c *gin.Context) {
 	utils.JsonSuccessResponse(c, nil)
 }
 
+func checkCorrectAnswer(question dao.QuestionList) error {
+	setting := question.QuestionSetting
+	if setting.CorrectAnswer == "" || (setting.QuestionType != 1 && setting.QuestionType != 2) {
+		return nil
+	}
+	answers := strings.Split(setting.CorrectAnswer, "┋")
+	if setting.QuestionType == 1 && len(answers) > 1 {
+		return errors.New("问题" + strconv.Itoa(question.SerialNum) + "为单选题, 只能有一个正确答案")
+	}
+	for _, answer := range answers {
+		found := false
+		for _, option := range question.Options {
+			if option.Content == answer {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.New("问题" + strconv.Itoa(question.SerialNum) + "的正确答案" + answer + "不是已有选项")
+		}
+	}
+	return nil
+}
+
+func checkSections(config dao.QuestionConfig) error {
+	sectionNums := make(map[int]bool, len(config.Sections))
+	for _, section := range config.Sections {
+		if section.SerialNum <= 0 {
+			return errors.New("分页序号必须大于0")
+		}
+		if sectionNums[section.SerialNum] {
+			return errors.New("分页序号" + strconv.Itoa(section.SerialNum) + "重复")
+		}
+		sectionNums[section.SerialNum] = true
+	}
+	for _, question := range config.QuestionList {
+		if question.SectionNum != 0 && !sectionNums[question.SectionNum] {
+			return errors.New("问题" + strconv.Itoa(question.SerialNum) + "所属分页不存在")
+		}
+	}
+	return nil
+}
+
+// checkAnonymity 检查匿名问卷的设置, 匿名问卷不能保存可与答卷关联的身份信息
+func checkAnonymity(config dao.BaseConfig) error {
+	if !config.Anonymous {
+		return nil
+	}
+	// 邀请记录包含受邀人的姓名和邮箱, 提交后会关联答卷
+	if config.InviteOnly {
+		return errors.New("匿名问卷不能设置为仅限邀请")
+	}
+	return service.CheckAnonymousKey()
+}
+
+func countBankQuestions(questions []dao.QuestionList) uint {
+	var num uint
+	for _, question := range questions {
+		if question.QuestionSetting.InBank {
+			num++
+		}
+	}
+	return num
+}
+
 func ensureMap(m map[int]map[int]int, key int) map[int]int {
 	if m[key] == nil {
 		m[key] = make(map[int]int)
@@ -947,7 +1314,7 @@ func DeleteAnswerSheet(c *gin.Context) {
 		code.AbortWithException(c, code.ServerError, err)
 	}
 	// 获取问卷
-	err = service.GetAnswerSheetByAnswerID(objectID)
+	_, err = service.GetAnswerSheetByAnswerID(objectID)
 	if errors.Is(err, mongo.ErrNoDocuments) {
 		code.AbortWithException(c, code.AnswerSheetNotExist, errors.New("答卷不存在"))
 		return
@@ -968,3 +1335,106 @@ func DeleteAnswerSheet(c *gin.Context) {
 	}
 	utils.JsonSuccessResponse(c, nil)
 }
+
+type getVoteTallyData struct {
+	ID       int    `form:"id" binding:"required"`
+	Method   string `form:"method" binding:"required,oneof=irv borda"` // 计票方式 irv:即时决选 borda:波达计数
+	Weighted bool   `form:"weighted"`                                  // 是否按权重名单加权计票
+}
+
+// GetVoteTally 按排序选票计票, 返回即时决选各轮结果或波达计数得分
+func GetVoteTally(c *gin.Context) {
+	var data getVoteTallyData
+	if err := c.ShouldBindQuery(&data); err != nil {
+		code.AbortWithException(c, code.ParamError, err)
+		return
+	}
+
+	user, err := service.GetUserSession(c)
+	if err != nil {
+		code.AbortWithException(c, code.NotLogin, err)
+		return
+	}
+
+	survey, err := service.GetSurveyByID(data.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		code.AbortWithException(c, code.SurveyNotExist, errors.New("问卷不存在"))
+		return
+	} else if err != nil {
+		code.AbortWithException(c, code.ServerError, err)
+		return
+	}
+
+	if (user.AdminType != 2) && (user.AdminType != 1 || survey.UserID != user.ID) &&
+		!service.UserInManage(user.ID, survey.ID) {
+		code.AbortWithException(c, code.NoPermission, errors.New(user.Username+"无权限"))
+		return
+	}
+
+	if survey.Type != 1 {
+		code.AbortWithException(c, code.SurveyTypeError, errors.New("问卷不是投票"))
+		return
+	}
+
+	results, err := service.GetVoteTally(survey, data.Method, data.Weighted)
+	if errors.Is(err, code.WeightedVoteError) {
+		code.AbortWithException(c, code.WeightedVoteError, err)
+		return
+	} else if errors.Is(err, code.AnonymousSurveyError) {
+		code.AbortWithException(c, code.AnonymousSurveyError, errors.New("匿名问卷不支持加权计票"))
+		return
+	} else if err != nil {
+		code.AbortWithException(c, code.ServerError, err)
+		return
+	}
+	utils.JsonSuccessResponse(c, gin.H{"tally": results})
+}
+
+type updateAccessCodeData struct {
+	ID         int    `json:"id" binding:"required"`
+	AccessCode string `json:"access_code"` // 新的访问码, 为空时随机生成
+	Disable    bool   `json:"disable"`     // 是否取消访问码
+}
+
+// UpdateAccessCode 更换或取消问卷访问码, 已发放的访问令牌随之失效
+func UpdateAccessCode(c *gin.Context) {
+	var data updateAccessCodeData
+	err := c.ShouldBindJSON(&data)
+	if err != nil {
+		code.AbortWithException(c, code.ParamError, err)
+		return
+	}
+	user, err := service.GetUserSession(c)
+	if err != nil {
+		code.AbortWithException(c, code.NotLogin, err)
+		return
+	}
+	survey, err := service.GetSurveyByID(data.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		code.AbortWithException(c, code.SurveyNotExist, errors.New("问卷不存在"))
+		return
+	} else if err != nil {
+		code.AbortWithException(c, code.ServerError, err)
+		return
+	}
+	// 判断权限
+	if (user.AdminType != 2) && (user.AdminType != 1 || survey.UserID != user.ID) &&
+		!service.UserInManage(user.ID, survey.ID) {
+		code.AbortWithException(c, code.NoPermission, errors.New(user.Username+"无权限"))
+		return
+	}
+	if data.Disable {
+		if err := service.ClearAccessCode(survey.ID); err != nil {
+			code.AbortWithException(c, code.ServerError, err)
+			return
+		}
+		utils.JsonSuccessResponse(c, gin.H{"access_code": ""})
+		return
+	}
+	accessCode, err := service.RotateAccessCode(survey.ID, strings.TrimSpace(data.AccessCode))
+	if err != nil {
+		code.AbortWithException(c, code.ServerError, err)
+		return
+	}
+	utils.JsonSuccessResponse(c, gin.H{"access_code": accessCode})
+}
@@ -10,17 +10,20 @@ import (
 
 type submitSurveyPayload struct {
 	ID            int                 `json:"id"`
+	StudentID     string              `json:"student_id"`
 	Time          string              `json:"time"`
 	QuestionsList []dao.QuestionsList `json:"questions_list"`
+	Meta          *dao.SubmitMeta     `json:"meta"`
 }
 
 // TypeSubmitSurvey 提交问卷任务类型
 const TypeSubmitSurvey = "survey:submit"
 
 // NewSubmitSurveyTask 创建提交问卷任务
-func NewSubmitSurveyTask(id int, questionsList []dao.QuestionsList) (*asynq.Task, error) {
-	payload, err := json.Marshal(submitSurveyPayload{ID: id, QuestionsList: questionsList,
-		Time: time.Now().Format("2006-01-02 15:04:05")})
+func NewSubmitSurveyTask(id int, stuId string, questionsList []dao.QuestionsList, meta *dao.SubmitMeta) (
+	*asynq.Task, error) {
+	payload, err := json.Marshal(submitSurveyPayload{ID: id, StudentID: stuId, QuestionsList: questionsList,
+		Time: time.Now().Format("2006-01-02 15:04:05"), Meta: meta})
 	if err != nil {
 		return nil, err
 	}
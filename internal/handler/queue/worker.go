@@ -16,7 +16,7 @@ func HandleSubmitSurveyTask(_ context.Context, t *asynq.Task) error {
 		return err
 	}
 	// 提交问卷
-	err := service.SubmitSurvey(p.ID, p.QuestionsList, p.Time)
+	_, err := service.SubmitSurvey(p.ID, p.StudentID, p.QuestionsList, p.Time, p.Meta)
 	if err != nil {
 		return errors.New("提交问卷失败原因: " + err.Error())
 	}
@@ -1,8 +1,10 @@
 package user
 
 import (
+	"encoding/json"
 	"errors"
 	"image"
+	"io"
 	"mime/multipart"
 	"path/filepath"
 	"sort"
@@ -20,12 +22,21 @@ import (
 	"github.com/google/uuid"
 	"github.com/zjutjh/WeJH-SDK/oauth"
 	"github.com/zjutjh/WeJH-SDK/oauth/oauthException"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
 )
 
 type submitSurveyData struct {
 	ID            int                 `json:"id" binding:"required"`
 	Token         string              `json:"token"`
+	ClientToken   string              `json:"client_token"` // 客户端令牌, 与获取问卷时返回的令牌一致
+	Edit          bool                `json:"edit"`         // 是否修改已提交的答卷
+	Receipt       string              `json:"receipt"`      // 提交回执, 凭回执修改答卷时填写
+	AccessToken   string              `json:"access_token"` // 访问令牌, 问卷设置了访问码时需要
+	Invitation    string              `json:"invitation"`   // 邀请令牌, 仅限邀请的问卷需要
+	Challenge     string              `json:"challenge"`    // 工作量证明挑战令牌, 与获取问卷时返回的一致
+	Nonce         string              `json:"nonce"`        // 工作量证明的解
 	QuestionsList []dao.QuestionsList `json:"questions_list"`
 }
 
@@ -43,24 +54,35 @@ func SubmitSurvey(c *gin.Context) {
 		code.AbortWithException(c, code.ServerError, err)
 		return
 	}
-	var userInfo oauth.UserInfo
-	if survey.Verify {
-		userInfo, err = utils.ParseJWT(data.Token)
-		if err != nil {
-			code.AbortWithException(c, code.ServerError, err)
-			return
-		}
+	respondent, ok := getRespondent(c, survey, data.Token, data.ClientToken)
+	if !ok {
+		return
 	}
-	stuId := userInfo.StudentID
+	userInfo, stuId := respondent.UserInfo, respondent.StuID
 	questions, err := service.GetQuestionsBySurveyID(survey.ID)
 	if err != nil {
 		code.AbortWithException(c, code.ServerError, err)
 		return
 	}
+	// 抽题问卷只校验该填写者抽到的题目
+	questions, err = service.GetDrawnQuestions(survey, questions, respondent.Key)
+	if errors.Is(err, code.DrawNotFound) {
+		code.AbortWithException(c, code.DrawNotFound, err)
+		return
+	} else if err != nil {
+		code.AbortWithException(c, code.ServerError, err)
+		return
+	}
+	// 展示块无需作答
+	questions = service.AnswerableQuestions(questions)
 	if len(questions) != len(data.QuestionsList) {
 		code.AbortWithException(c, code.SurveyError, errors.New("问卷问题和上传问题数量不一致"))
 		return
 	}
+	questionIDs := make(map[int]bool, len(questions))
+	for _, question := range questions {
+		questionIDs[question.ID] = true
+	}
 	// 判断填写时间是否在问卷有效期内
 	if !survey.Deadline.IsZero() && survey.Deadline.Before(time.Now()) {
 		code.AbortWithException(c, code.TimeBeyondError, errors.New("填写时间已过"))
@@ -70,11 +92,52 @@ func SubmitSurvey(c *gin.Context) {
 		code.AbortWithException(c, code.TimeBeyondError, errors.New("填写时间未到"))
 		return
 	}
+	// 判断问卷填写数量是否已达上限, 修改答卷不占用新的名额
+	if !data.Edit && survey.IsFull() {
+		code.AbortWithException(c, code.SurveyFullError, errors.New("问卷填写数量已达上限"))
+		return
+	}
 	// 判断问卷是否开放
 	if survey.Status != 2 {
 		code.AbortWithException(c, code.SurveyNotOpen, errors.New("问卷未开放"))
 		return
 	}
+	// 判断访问令牌
+	if !service.CheckAccessToken(survey, data.AccessToken) {
+		code.AbortWithException(c, code.AccessTokenError, errors.New("访问令牌无效"))
+		return
+	}
+	// 获取要修改的答卷
+	var previous *dao.AnswerSheet
+	if data.Edit {
+		if !survey.AllowEdit {
+			code.AbortWithException(c, code.EditNotAllowed, errors.New("问卷不允许修改答卷"))
+			return
+		}
+		// 有回执时修改回执对应的答卷, 否则修改统一验证填写者最近提交的答卷, 匿名问卷只能凭回执修改
+		switch {
+		case data.Receipt != "":
+			previous, err = service.GetSubmissionByReceipt(data.Receipt)
+			if err == nil && (previous.SurveyID != survey.ID || (previous.StudentID != "" && previous.StudentID != stuId)) {
+				err = code.ReceiptInvalid
+			}
+		case survey.Verify && !survey.Anonymous:
+			previous, err = service.GetLatestSubmission(survey.ID, stuId)
+		default:
+			code.AbortWithException(c, code.ParamError, errors.New("提交回执为空"))
+			return
+		}
+		if errors.Is(err, code.ReceiptInvalid) {
+			code.AbortWithException(c, code.ReceiptInvalid, err)
+			return
+		} else if errors.Is(err, mongo.ErrNoDocuments) {
+			code.AbortWithException(c, code.AnswerSheetNotExist, errors.New("未找到已提交的答卷"))
+			return
+		} else if err != nil {
+			code.AbortWithException(c, code.ServerError, err)
+			return
+		}
+	}
 	// 逐个判断问题答案
 	for _, q := range data.QuestionsList {
 		question, err := service.GetQuestionByID(q.QuestionID)
@@ -87,6 +150,13 @@ func SubmitSurvey(c *gin.Context) {
 				errors.New("问题"+strconv.Itoa(question.SerialNum)+"不属于该问卷"))
 			return
 		}
+		// 判断问题是否在填写者需作答的题目中且未重复作答
+		if !questionIDs[question.ID] {
+			code.AbortWithException(c, code.SurveyError,
+				errors.New("问题"+strconv.Itoa(question.SerialNum)+"不在作答范围内或重复作答"))
+			return
+		}
+		delete(questionIDs, question.ID)
 		// 判断必填字段是否为空
 		if question.Required && q.Answer == "" {
 			code.AbortWithException(c, code.ServerError,
@@ -94,8 +164,13 @@ func SubmitSurvey(c *gin.Context) {
 			return
 		}
 		// 判断多选题选项数量是否符合要求
-		if (question.QuestionType == 2 && survey.Type == 0) || (question.QuestionType == 1 && survey.Type == 1) {
-			length := uint(len(strings.Split(q.Answer, "┋")))
+		if (question.QuestionType == 2 && survey.Type != 1) || (question.QuestionType == 1 && survey.Type == 1) {
+			answers := strings.Split(q.Answer, "┋")
+			if hasDuplicate(answers) {
+				code.AbortWithException(c, code.OptionNumError, errors.New("问题"+strconv.Itoa(q.QuestionID)+"选项重复"))
+				return
+			}
+			length := uint(len(answers))
 			if question.MinimumOption != 0 && length < question.MinimumOption {
 				code.AbortWithException(c, code.OptionNumError, errors.New("问题"+strconv.Itoa(q.QuestionID)+"选项数量不符合要求"))
 				return
@@ -106,70 +181,258 @@ func SubmitSurvey(c *gin.Context) {
 			}
 		}
 	}
-	flagSum, flagDay := false, false
-
-	if survey.Verify {
-		var err error
-		if userInfo.UserTypeDesc != "本科生" {
-			code.AbortWithException(c, code.NotUnderGraduateError, errors.New("当前问卷仅允许本科生回答"))
+	if survey.Verify && !checkRespondent(c, survey, userInfo) {
+		return
+	}
+	// 校验工作量证明, 挑战校验后即失效
+	if survey.ProofOfWork {
+		err = service.VerifyChallenge(survey.ID, data.Challenge, data.Nonce)
+		if errors.Is(err, code.ChallengeError) {
+			code.AbortWithException(c, code.ChallengeError, err)
+			return
+		} else if err != nil {
+			code.AbortWithException(c, code.ServerError, err)
 			return
 		}
-		// 统一检查总投票次数和每日投票次数
-		if flagSum, err = service.CheckLimit(c, stuId, survey, "sumLimit", int(survey.SumLimit)); err != nil {
-			if err.Error() == "sumLimit已达上限" {
-				code.AbortWithException(c, code.VoteSumLimitError, errors.New("总投票次数已达上限"))
-			} else {
-				code.AbortWithException(c, code.ServerError, err)
-			}
+	}
+	// 提交前原子地占用IP和设备的提交次数, 修改答卷不计入次数
+	deviceID, _ := c.Cookie(deviceCookie)
+	useRate := !data.Edit
+	if useRate {
+		err = service.ReserveSubmitRate(survey, c.ClientIP(), deviceID)
+		if errors.Is(err, code.IPLimitError) {
+			code.AbortWithException(c, code.IPLimitError, err)
+			return
+		} else if errors.Is(err, code.DeviceLimitError) {
+			code.AbortWithException(c, code.DeviceLimitError, err)
+			return
+		} else if err != nil {
+			code.AbortWithException(c, code.ServerError, err)
 			return
 		}
-
-		if flagDay, err = service.CheckLimit(c, stuId, survey, "dailyLimit", int(survey.DailyLimit)); err != nil {
-			if err.Error() == "dailyLimit已达上限" {
-				code.AbortWithException(c, code.VoteLimitError, errors.New("单日投票次数已达上限"))
-			} else {
-				code.AbortWithException(c, code.ServerError, err)
-			}
+	}
+	// 提交前原子地占用投票次数, 修改答卷不消耗投票次数
+	useVote := survey.Verify && !data.Edit
+	if useVote {
+		err = service.ReserveVoteLimit(stuId, survey)
+		if err != nil && useRate {
+			releaseSubmitRate(c, survey, deviceID)
+		}
+		if errors.Is(err, code.VoteSumLimitError) {
+			code.AbortWithException(c, code.VoteSumLimitError, errors.New("总投票次数已达上限"))
+			return
+		} else if errors.Is(err, code.VoteLimitError) {
+			code.AbortWithException(c, code.VoteLimitError, errors.New("单日投票次数已达上限"))
+			return
+		} else if err != nil {
+			code.AbortWithException(c, code.ServerError, err)
 			return
 		}
 	}
-	err = service.SubmitSurvey(data.ID, data.QuestionsList, time.Now().Format("2006-01-02 15:04:05"))
-	if err != nil {
+	// 仅限邀请的问卷提交前占用邀请, 修改答卷无需邀请
+	useInvitation := survey.InviteOnly && !data.Edit
+	if useInvitation {
+		err = service.UseInvitation(survey, data.Invitation)
+		if err != nil && useVote {
+			releaseVoteLimit(survey, stuId)
+		}
+		if err != nil && useRate {
+			releaseSubmitRate(c, survey, deviceID)
+		}
+		if errors.Is(err, code.InvitationInvalidError) {
+			code.AbortWithException(c, code.InvitationInvalidError, err)
+			return
+		} else if errors.Is(err, code.InvitationUsedError) {
+			code.AbortWithException(c, code.InvitationUsedError, err)
+			return
+		} else if err != nil {
+			code.AbortWithException(c, code.ServerError, err)
+			return
+		}
+	}
+	var answerSheet dao.AnswerSheet
+	if data.Edit {
+		answerSheet, err = service.EditSubmission(survey, previous, data.QuestionsList,
+			time.Now().Format("2006-01-02 15:04:05"))
+	} else {
+		var meta *dao.SubmitMeta
+		meta, err = service.NewSubmitMeta(survey, respondent.Key, c.ClientIP(), c.Request.UserAgent())
+		if err == nil {
+			answerSheet, err = service.SubmitSurvey(data.ID, stuId, data.QuestionsList,
+				time.Now().Format("2006-01-02 15:04:05"), meta)
+		}
+	}
+	if err != nil && useVote {
+		// 提交失败时归还投票次数
+		releaseVoteLimit(survey, stuId)
+	}
+	if err != nil && useRate {
+		// 提交失败时归还提交次数
+		releaseSubmitRate(c, survey, deviceID)
+	}
+	if err != nil && useInvitation {
+		// 提交失败时归还邀请
+		if e := service.ReleaseInvitation(survey, data.Invitation); e != nil {
+			zap.L().Error("Failed to release invitation", zap.Int("survey_id", survey.ID), zap.Error(e))
+		}
+	}
+	if apiErr, ok := service.IsUniqueError(err); ok {
+		code.AbortWithException(c, apiErr, err)
+		return
+	} else if errors.Is(err, code.SurveyFullError) {
+		code.AbortWithException(c, code.SurveyFullError, err)
+		return
+	} else if err != nil {
 		code.AbortWithException(c, code.ServerError, err)
 		return
 	}
 
-	if survey.Verify {
-		if survey.DailyLimit > 0 {
-			err := service.UpdateVoteLimit(c, stuId, survey.ID, flagDay, "dailyLimit")
-			if err != nil {
-				code.AbortWithException(c, code.ServerError, err)
-				return
-			}
+	if survey.Verify && !data.Edit {
+		// 记录授权
+		if survey.Anonymous {
+			err = service.CreateAnonymousRecord(stuId, data.ID)
+		} else {
+			err = service.CreateOauthRecord(userInfo, time.Now(), data.ID, answerSheet.AnswerID)
 		}
-		if survey.SumLimit > 0 {
-			err := service.UpdateVoteLimit(c, stuId, survey.ID, flagSum, "sumLimit")
-			if err != nil {
-				code.AbortWithException(c, code.ServerError, err)
-				return
-			}
+		if err != nil {
+			code.AbortWithException(c, code.ServerError, err)
+			return
 		}
-		// 记录授权
-		if err = service.CreateOauthRecord(userInfo, time.Now(), data.ID); err != nil {
+	}
+	// 匿名问卷不将答卷关联到包含受邀人身份的邀请
+	if useInvitation && !survey.Anonymous {
+		err := service.BindInvitationAnswer(survey, data.Invitation, answerSheet.AnswerID.Hex())
+		if err != nil {
+			zap.L().Error("Failed to bind invitation answer", zap.Int("survey_id", survey.ID), zap.Error(err))
+		}
+	}
+	// 提交成功后清除草稿
+	if err := service.DeleteDraft(survey.ID, respondent.Key); err != nil {
+		zap.L().Error("Failed to delete draft", zap.Int("survey_id", survey.ID), zap.Error(err))
+	}
+	response := gin.H{
+		"answer_id": answerSheet.AnswerID,
+		"receipt":   service.NewReceipt(answerSheet),
+	}
+	// 测验问卷按设置返回得分和解析
+	if survey.Type == 2 && survey.ShowScore {
+		result, err := service.GetQuizResult(answerSheet)
+		if err != nil {
 			code.AbortWithException(c, code.ServerError, err)
 			return
 		}
+		response["quiz_result"] = result
 	}
-	utils.JsonSuccessResponse(c, nil)
+	utils.JsonSuccessResponse(c, response)
 }
 
-type getSurveyData struct {
-	ID int `form:"id" binding:"required"`
+// hasDuplicate 判断多选题答案中是否有重复的选项
+func hasDuplicate(answers []string) bool {
+	seen := make(map[string]bool, len(answers))
+	for _, answer := range answers {
+		if seen[answer] {
+			return true
+		}
+		seen[answer] = true
+	}
+	return false
+}
+
+// releaseVoteLimit 归还已占用的投票次数
+func releaseVoteLimit(survey *model.Survey, stuId string) {
+	if err := service.ReleaseVoteLimit(stuId, survey); err != nil {
+		zap.L().Error("Failed to release vote limit", zap.Int("survey_id", survey.ID), zap.Error(err))
+	}
+}
+
+// releaseSubmitRate 归还已占用的IP和设备提交次数
+func releaseSubmitRate(c *gin.Context, survey *model.Survey, deviceID string) {
+	if err := service.ReleaseSubmitRate(survey, c.ClientIP(), deviceID); err != nil {
+		zap.L().Error("Failed to release submit rate", zap.Int("survey_id", survey.ID), zap.Error(err))
+	}
+}
+
+// deviceCookie 保存设备标识的 cookie 名称
+const deviceCookie = "qa_device"
+
+// respondent 问卷的填写者
+type respondent struct {
+	UserInfo oauth.UserInfo // 统一验证的用户信息, 未统一验证的问卷为空
+	StuID    string         // 识别统一验证填写者的标识, 匿名问卷为学号的 HMAC, 未统一验证的问卷为空
+	Key      string         // 填写者标识, 抽题、打乱顺序、草稿和填写用时均以此区分填写者
+}
+
+// getRespondent 获取填写者, 获取问卷、保存草稿和提交答卷须使用同一标识
+// 仅统一验证问卷从统一验证令牌中获取学号, 令牌为空或无效时中止请求并返回 false
+func getRespondent(c *gin.Context, survey *model.Survey, token string, clientToken string) (respondent, bool) {
+	if !survey.Verify {
+		return respondent{Key: service.RespondentKey("", clientToken)}, true
+	}
+	if token == "" {
+		code.AbortWithException(c, code.NotLogin, errors.New("统一验证令牌为空"))
+		return respondent{}, false
+	}
+	userInfo, err := utils.ParseJWT(token)
+	if err != nil {
+		code.AbortWithException(c, code.NotLogin, err)
+		return respondent{}, false
+	}
+	// 匿名问卷只使用学号的 HMAC 识别填写者
+	stuId, err := service.RespondentID(survey, userInfo.StudentID)
+	if err != nil {
+		code.AbortWithException(c, code.ServerError, err)
+		return respondent{}, false
+	}
+	return respondent{UserInfo: userInfo, StuID: stuId, Key: service.RespondentKey(stuId, clientToken)}, true
+}
+
+// checkRespondent 判断统一验证的填写者是否有资格填写问卷, 没有资格时中止请求并返回 false
+func checkRespondent(c *gin.Context, survey *model.Survey, userInfo oauth.UserInfo) bool {
+	if apiErr := service.CheckEligibility(survey, userInfo); apiErr != nil {
+		code.AbortWithException(c, apiErr, apiErr)
+		return false
+	}
+	err := service.CheckRoster(survey.ID, userInfo.StudentID)
+	if errors.Is(err, code.NotInRosterError) {
+		code.AbortWithException(c, code.NotInRosterError, err)
+		return false
+	} else if errors.Is(err, code.RosterDeniedError) {
+		code.AbortWithException(c, code.RosterDeniedError, err)
+		return false
+	} else if err != nil {
+		code.AbortWithException(c, code.ServerError, err)
+		return false
+	}
+	return true
+}
+
+// checkInvitation 判断邀请令牌是否可以使用, 不可使用时中止请求并返回 false
+func checkInvitation(c *gin.Context, survey *model.Survey, token string) bool {
+	err := service.CheckInvitation(survey, token)
+	if errors.Is(err, code.InvitationInvalidError) {
+		code.AbortWithException(c, code.InvitationInvalidError, err)
+		return false
+	} else if errors.Is(err, code.InvitationUsedError) {
+		code.AbortWithException(c, code.InvitationUsedError, err)
+		return false
+	} else if err != nil {
+		code.AbortWithException(c, code.ServerError, err)
+		return false
+	}
+	return true
+}
+
+type getSurveyQuestionsData struct {
+	ID          int    `form:"id" binding:"required"`
+	Token       string `form:"token"`        // 统一验证令牌
+	ClientToken string `form:"client_token"` // 客户端令牌, 未统一验证时用于标识填写者
+	AccessToken string `form:"access_token"` // 访问令牌, 问卷设置了访问码时需要
+	Invitation  string `form:"invitation"`   // 邀请令牌, 仅限邀请的问卷需要
 }
 
 // GetSurvey 用户获取问卷
 func GetSurvey(c *gin.Context) {
-	var data getSurveyData
+	var data getSurveyQuestionsData
 	err := c.ShouldBindQuery(&data)
 	if err != nil {
 		code.AbortWithException(c, code.ParamError, err)
@@ -186,6 +449,11 @@ func GetSurvey(c *gin.Context) {
 		code.AbortWithException(c, code.TimeBeyondError, errors.New("问卷填写时间已截至"))
 		return
 	}
+	// 判断问卷填写数量是否已达上限
+	if survey.IsFull() {
+		code.AbortWithException(c, code.SurveyFullError, errors.New("问卷填写数量已达上限"))
+		return
+	}
 	// 判断问卷是否开放
 	if survey.Status != 2 {
 		code.AbortWithException(c, code.SurveyNotOpen, errors.New("问卷未开放"))
@@ -195,20 +463,65 @@ func GetSurvey(c *gin.Context) {
 		code.AbortWithException(c, code.SurveyNotOpen, errors.New("问卷未开放"))
 		return
 	}
+	// 判断访问令牌
+	if !service.CheckAccessToken(survey, data.AccessToken) {
+		code.AbortWithException(c, code.AccessTokenError, errors.New("访问令牌无效"))
+		return
+	}
+	// 判断邀请令牌
+	if survey.InviteOnly && !checkInvitation(c, survey, data.Invitation) {
+		return
+	}
+	if data.ClientToken == "" {
+		data.ClientToken = service.NewClientToken()
+	}
+	// 确定填写者标识, 用于生成稳定的打乱顺序
+	respondent, ok := getRespondent(c, survey, data.Token, data.ClientToken)
+	if !ok {
+		return
+	}
+	// 统一验证问卷提前判断填写资格
+	if survey.Verify && !checkRespondent(c, survey, respondent.UserInfo) {
+		return
+	}
+	respondentKey := respondent.Key
+	seed := service.ShuffleSeed(survey.ID, respondentKey)
+	// 记录首次获取问卷的时间, 用于计算填写用时
+	if err := service.RecordSurveyOpened(survey.ID, respondentKey); err != nil {
+		zap.L().Error("Failed to record survey opened", zap.Int("survey_id", survey.ID), zap.Error(err))
+	}
 	// 获取相应的问题
 	questions, err := service.GetQuestionsBySurveyID(survey.ID)
 	if err != nil {
 		code.AbortWithException(c, code.ServerError, err)
 		return
 	}
-	// 构建问卷响应
+	// 从题库中抽题
+	questions, err = service.DrawQuestions(survey, questions, respondentKey)
+	if err != nil {
+		code.AbortWithException(c, code.ServerError, err)
+		return
+	}
+	if survey.Shuffle {
+		questions = service.ShuffleQuestions(questions, seed)
+	}
+	sections, err := service.GetSectionsBySurveyID(survey.ID)
+	if err != nil {
+		code.AbortWithException(c, code.ServerError, err)
+		return
+	}
+	// 构建问卷响应, 不分页的题目放在 question_list 中, 分页题目按分页放在 sections 中
 	questionListsResponse := make([]map[string]any, 0)
+	sectionQuestions := make(map[int][]map[string]any, len(sections))
 	for _, question := range questions {
 		options, err := service.GetOptionsByQuestionID(question.ID)
 		if err != nil {
 			code.AbortWithException(c, code.ServerError, err)
 			return
 		}
+		if question.Shuffle {
+			options = service.ShuffleOptions(options, seed, question.ID)
+		}
 		optionsResponse := make([]map[string]any, 0)
 		for _, option := range options {
 			optionResponse := map[string]any{
@@ -228,6 +541,7 @@ func GetSurvey(c *gin.Context) {
 			"reg":            question.Reg,
 			"maximum_option": question.MaximumOption,
 			"minimum_option": question.MinimumOption,
+			"shuffle":        question.Shuffle,
 		}
 
 		questionListMap := map[string]any{
@@ -239,32 +553,294 @@ func GetSurvey(c *gin.Context) {
 			"ques_setting": questionSettingResponse,
 			"options":      optionsResponse,
 		}
-		questionListsResponse = append(questionListsResponse, questionListMap)
+		if question.SectionID == 0 {
+			questionListsResponse = append(questionListsResponse, questionListMap)
+		} else {
+			sectionQuestions[question.SectionID] = append(sectionQuestions[question.SectionID], questionListMap)
+		}
+	}
+	sectionsResponse := make([]map[string]any, 0, len(sections))
+	for _, section := range sections {
+		questionList := sectionQuestions[section.ID]
+		if questionList == nil {
+			questionList = make([]map[string]any, 0)
+		}
+		sectionsResponse = append(sectionsResponse, map[string]any{
+			"id":            section.ID,
+			"serial_num":    section.SerialNum,
+			"title":         section.Title,
+			"description":   section.Description,
+			"img":           section.Img,
+			"question_list": questionList,
+		})
 	}
 
 	questionsConfigResponse := map[string]any{
 		"title":         survey.Title,
 		"desc":          survey.Desc,
 		"question_list": questionListsResponse,
+		"sections":      sectionsResponse,
 	}
 	baseConfigResponse := map[string]any{
-		"start_time": survey.StartTime,
-		"end_time":   survey.Deadline,
-		"day_limit":  survey.DailyLimit,
-		"sum_limit":  survey.SumLimit,
-		"verify":     survey.Verify,
+		"start_time":     survey.StartTime,
+		"end_time":       survey.Deadline,
+		"day_limit":      survey.DailyLimit,
+		"sum_limit":      survey.SumLimit,
+		"verify":         survey.Verify,
+		"max_num":        survey.MaxNum,
+		"shuffle":        survey.Shuffle,
+		"draw_num":       survey.DrawNum,
+		"show_score":     survey.ShowScore,
+		"allow_edit":     survey.AllowEdit,
+		"anonymous":      survey.Anonymous,
+		"invite_only":    survey.InviteOnly,
+		"proof_of_work":  survey.ProofOfWork,
+		"ip_limit":       survey.IPLimit,
+		"device_limit":   survey.DeviceLimit,
+		"result_visible": survey.ResultVisible,
+		"result_top_n":   survey.ResultTopN,
+		"eligibility":    service.GetEligibility(survey),
+	}
+	// 获取未提交的草稿
+	draft, err := service.GetDraft(survey.ID, respondentKey)
+	if err != nil {
+		code.AbortWithException(c, code.ServerError, err)
+		return
 	}
 	response := map[string]any{
-		"id":          survey.ID,
-		"status":      survey.Status,
-		"survey_type": survey.Type,
-		"base_config": baseConfigResponse,
-		"ques_config": questionsConfigResponse,
+		"id":           survey.ID,
+		"status":       survey.Status,
+		"survey_type":  survey.Type,
+		"base_config":  baseConfigResponse,
+		"ques_config":  questionsConfigResponse,
+		"client_token": data.ClientToken,
+		"draft":        draft,
+	}
+	// 下发工作量证明挑战, 提交时需附带挑战的解
+	if survey.ProofOfWork {
+		challenge, err := service.NewChallenge(survey.ID)
+		if err != nil {
+			code.AbortWithException(c, code.ServerError, err)
+			return
+		}
+		response["challenge"] = challenge
+	}
+	// 限制设备提交次数时为没有设备标识的填写者设置 cookie
+	if survey.DeviceLimit > 0 {
+		if _, err := c.Cookie(deviceCookie); err != nil {
+			c.SetCookie(deviceCookie, service.NewDeviceID(), 365*24*3600, "/", "", false, true)
+		}
 	}
 
 	utils.JsonSuccessResponse(c, response)
 }
 
+type saveDraftData struct {
+	ID            int                 `json:"id" binding:"required"`
+	Token         string              `json:"token"`        // 统一验证令牌
+	ClientToken   string              `json:"client_token"` // 客户端令牌, 未统一验证时作为续填令牌
+	AccessToken   string              `json:"access_token"` // 访问令牌, 问卷设置了访问码时需要
+	QuestionsList []dao.QuestionsList `json:"questions_list"`
+}
+
+// SaveDraft 保存问卷草稿
+func SaveDraft(c *gin.Context) {
+	var data saveDraftData
+	err := c.ShouldBindJSON(&data)
+	if err != nil {
+		code.AbortWithException(c, code.ParamError, err)
+		return
+	}
+	survey, err := service.GetSurveyByID(data.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		code.AbortWithException(c, code.SurveyNotExist, errors.New("问卷不存在"))
+		return
+	} else if err != nil {
+		code.AbortWithException(c, code.ServerError, err)
+		return
+	}
+	if survey.Status != 2 {
+		code.AbortWithException(c, code.SurveyNotOpen, errors.New("问卷未开放"))
+		return
+	}
+	if !survey.Deadline.IsZero() && survey.Deadline.Before(time.Now()) {
+		code.AbortWithException(c, code.TimeBeyondError, errors.New("填写时间已过"))
+		return
+	}
+	if !service.CheckAccessToken(survey, data.AccessToken) {
+		code.AbortWithException(c, code.AccessTokenError, errors.New("访问令牌无效"))
+		return
+	}
+	// 统一验证问卷以学号保存草稿, 否则以客户端令牌保存
+	if !survey.Verify && data.ClientToken == "" {
+		code.AbortWithException(c, code.ParamError, errors.New("客户端令牌为空"))
+		return
+	}
+	respondent, ok := getRespondent(c, survey, data.Token, data.ClientToken)
+	if !ok {
+		return
+	}
+	err = service.SaveDraft(survey, respondent.Key, data.QuestionsList)
+	if err != nil {
+		code.AbortWithException(c, code.ServerError, err)
+		return
+	}
+	utils.JsonSuccessResponse(c, nil)
+}
+
+type exchangeAccessCodeData struct {
+	ID         int    `json:"id" binding:"required"`
+	AccessCode string `json:"access_code" binding:"required"`
+}
+
+// ExchangeAccessCode 使用访问码换取访问令牌
+func ExchangeAccessCode(c *gin.Context) {
+	var data exchangeAccessCodeData
+	err := c.ShouldBindJSON(&data)
+	if err != nil {
+		code.AbortWithException(c, code.ParamError, err)
+		return
+	}
+	survey, err := service.GetSurveyByID(data.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		code.AbortWithException(c, code.SurveyNotExist, errors.New("问卷不存在"))
+		return
+	} else if err != nil {
+		code.AbortWithException(c, code.ServerError, err)
+		return
+	}
+	if survey.Status != 2 {
+		code.AbortWithException(c, code.SurveyNotOpen, errors.New("问卷未开放"))
+		return
+	}
+	if survey.AccessCode == "" {
+		utils.JsonSuccessResponse(c, gin.H{"access_token": ""})
+		return
+	}
+	token, err := service.ExchangeAccessCode(survey, data.AccessCode, c.ClientIP())
+	if errors.Is(err, code.AccessCodeError) {
+		code.AbortWithException(c, code.AccessCodeError, err)
+		return
+	} else if errors.Is(err, code.AccessAttemptLimitError) {
+		code.AbortWithException(c, code.AccessAttemptLimitError, err)
+		return
+	} else if err != nil {
+		code.AbortWithException(c, code.ServerError, err)
+		return
+	}
+	utils.JsonSuccessResponse(c, gin.H{"access_token": token})
+}
+
+type getSubmissionData struct {
+	ID    int    `form:"id" binding:"required"`
+	Token string `form:"token" binding:"required"` // 统一验证令牌
+}
+
+// GetSubmission 填写者获取自己最近提交的答卷
+func GetSubmission(c *gin.Context) {
+	var data getSubmissionData
+	err := c.ShouldBindQuery(&data)
+	if err != nil {
+		code.AbortWithException(c, code.ParamError, err)
+		return
+	}
+	survey, err := service.GetSurveyByID(data.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		code.AbortWithException(c, code.SurveyNotExist, errors.New("问卷不存在"))
+		return
+	} else if err != nil {
+		code.AbortWithException(c, code.ServerError, err)
+		return
+	}
+	if !survey.Verify || !survey.AllowEdit {
+		code.AbortWithException(c, code.EditNotAllowed, errors.New("问卷不允许修改答卷"))
+		return
+	}
+	// 匿名问卷的答卷不记录填写者, 只能凭提交回执获取
+	if survey.Anonymous {
+		code.AbortWithException(c, code.EditNotAllowed, errors.New("匿名问卷只能凭提交回执修改答卷"))
+		return
+	}
+	userInfo, err := utils.ParseJWT(data.Token)
+	if err != nil {
+		code.AbortWithException(c, code.ServerError, err)
+		return
+	}
+	stuId, err := service.RespondentID(survey, userInfo.StudentID)
+	if err != nil {
+		code.AbortWithException(c, code.ServerError, err)
+		return
+	}
+	answerSheet, err := service.GetLatestSubmission(survey.ID, stuId)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		code.AbortWithException(c, code.AnswerSheetNotExist, errors.New("未找到已提交的答卷"))
+		return
+	} else if err != nil {
+		code.AbortWithException(c, code.ServerError, err)
+		return
+	}
+	utils.JsonSuccessResponse(c, gin.H{
+		"answer_id":      answerSheet.AnswerID,
+		"time":           answerSheet.Time,
+		"questions_list": submittedAnswers(answerSheet),
+		"editable":       survey.IsEditable(),
+	})
+}
+
+type verifyReceiptData struct {
+	Receipt string `form:"receipt" binding:"required"` // 提交回执
+}
+
+// VerifyReceipt 验证提交回执
+func VerifyReceipt(c *gin.Context) {
+	var data verifyReceiptData
+	err := c.ShouldBindQuery(&data)
+	if err != nil {
+		code.AbortWithException(c, code.ParamError, err)
+		return
+	}
+	answerSheet, err := service.GetSubmissionByReceipt(data.Receipt)
+	if errors.Is(err, code.ReceiptInvalid) {
+		code.AbortWithException(c, code.ReceiptInvalid, err)
+		return
+	} else if errors.Is(err, mongo.ErrNoDocuments) {
+		code.AbortWithException(c, code.AnswerSheetNotExist, errors.New("答卷不存在"))
+		return
+	} else if err != nil {
+		code.AbortWithException(c, code.ServerError, err)
+		return
+	}
+	survey, err := service.GetSurveyByID(answerSheet.SurveyID)
+	if err != nil {
+		code.AbortWithException(c, code.ServerError, err)
+		return
+	}
+	response := gin.H{
+		"survey_id": survey.ID,
+		"title":     survey.Title,
+		"answer_id": answerSheet.AnswerID,
+		"time":      answerSheet.Time,
+		"editable":  survey.IsEditable(),
+	}
+	// 按问卷设置展示已提交的答案
+	if survey.ReceiptAnswers {
+		response["questions_list"] = submittedAnswers(answerSheet)
+	}
+	utils.JsonSuccessResponse(c, response)
+}
+
+// submittedAnswers 将答卷转换为与提交时相同格式的答案列表
+func submittedAnswers(answerSheet *dao.AnswerSheet) []dao.QuestionsList {
+	questionsList := make([]dao.QuestionsList, 0, len(answerSheet.Answers))
+	for _, answer := range answerSheet.Answers {
+		questionsList = append(questionsList, dao.QuestionsList{
+			QuestionID: answer.QuestionID,
+			Answer:     answer.Content,
+		})
+	}
+	return questionsList
+}
+
 // UploadImg 上传图片
 func UploadImg(c *gin.Context) {
 	// 获取文件
@@ -397,9 +973,30 @@ type getSurveyStatisticsResponse struct {
 	Options      []getOptionCount `json:"options"`       // 选项内容
 }
 
+type getSurveyStatisticsData struct {
+	ID    int    `form:"id" binding:"required"`
+	Token string `form:"token"` // 统一验证令牌, 仅已投票者可见结果时需要
+}
+
+// checkResultVisibility 判断投票结果是否可见, 不可见时中止请求并返回 false
+func checkResultVisibility(c *gin.Context, survey *model.Survey, token string) bool {
+	err := service.CheckResultVisibility(survey, token)
+	if errors.Is(err, code.ResultHiddenError) {
+		code.AbortWithException(c, code.ResultHiddenError, err)
+		return false
+	} else if errors.Is(err, code.ResultNotVotedError) {
+		code.AbortWithException(c, code.ResultNotVotedError, err)
+		return false
+	} else if err != nil {
+		code.AbortWithException(c, code.ServerError, err)
+		return false
+	}
+	return true
+}
+
 // GetSurveyStatistics 获取投票统计
 func GetSurveyStatistics(c *gin.Context) {
-	var data getSurveyData
+	var data getSurveyStatisticsData
 	err := c.ShouldBindQuery(&data)
 	if err != nil {
 		code.AbortWithException(c, code.ParamError, err)
@@ -414,7 +1011,12 @@ func GetSurveyStatistics(c *gin.Context) {
 		code.AbortWithException(c, code.SurveyTypeError, errors.New("问卷为调研问卷"))
 		return
 	}
-	answerSheets, err := service.GetSurveyAnswersBySurveyID(data.ID)
+	// 判断投票结果是否对该填写者可见
+	if !checkResultVisibility(c, survey, data.Token) {
+		return
+	}
+	// 从 Redis 实时计数中获取各选项票数
+	optionCounts, err := service.GetVoteCounts(data.ID)
 	if err != nil {
 		code.AbortWithException(c, code.ServerError, err)
 		return
@@ -426,132 +1028,28 @@ func GetSurveyStatistics(c *gin.Context) {
 		return
 	}
 
-	// 如果 answerSheets 为空，则返回所有问题和选项统计为 0
-	if len(answerSheets) == 0 {
-		response := make([]getSurveyStatisticsResponse, 0, len(questions))
-		for _, q := range questions {
-			options, err := service.GetOptionsByQuestionID(q.ID)
-			if err != nil {
-				code.AbortWithException(c, code.ServerError, err)
-				return
-			}
-
-			qOptions := make([]getOptionCount, 0, len(options)+1)
-			for _, option := range options {
-				qOptions = append(qOptions, getOptionCount{
-					SerialNum: option.SerialNum,
-					Content:   option.Content,
-					Count:     0,
-					Rank:      1,
-				})
-			}
-
-			// 如果支持 "其他" 选项，添加一项
-			if q.OtherOption {
-				qOptions = append(qOptions, getOptionCount{
-					SerialNum: 0,
-					Content:   "其他",
-					Count:     0,
-					Rank:      1,
-				})
-			}
-
-			response = append(response, getSurveyStatisticsResponse{
-				SerialNum:    q.SerialNum,
-				Question:     q.Subject,
-				QuestionType: q.QuestionType,
-				Options:      qOptions,
-			})
-		}
-		utils.JsonSuccessResponse(c, gin.H{"statistics": response})
-		return
-	}
-
-	// 问题编号对应的问题
-	questionMap := make(map[int]model.Question)
-	// 问题编号对应的选项们
-	optionsMap := make(map[int][]model.Option)
-	// 问题编号与选项内容对应的选项
-	optionAnswerMap := make(map[int]map[string]model.Option)
-	// 问题编号与选项序号对应的选项
-	optionSerialNumMap := make(map[int]map[int]model.Option)
-	for _, question := range questions {
-		questionMap[question.ID] = question
-		optionAnswerMap[question.ID] = make(map[string]model.Option)
-		optionSerialNumMap[question.ID] = make(map[int]model.Option)
-		options, err := service.GetOptionsByQuestionID(question.ID)
+	response := make([]getSurveyStatisticsResponse, 0, len(questions))
+	for _, q := range service.AnswerableQuestions(questions) {
+		options, err := service.GetOptionsByQuestionID(q.ID)
 		if err != nil {
 			code.AbortWithException(c, code.ServerError, err)
 			return
 		}
-		optionsMap[question.ID] = options
-		for _, option := range options {
-			optionAnswerMap[question.ID][option.Content] = option
-			optionSerialNumMap[question.ID][option.SerialNum] = option
-		}
-	}
-
-	// 问题编号对应的选项编号对应的选项数量
-	optionCounts := make(map[int]map[int]int)
-	for _, sheet := range answerSheets {
-		for _, answer := range sheet.Answers {
-			options := optionsMap[answer.QuestionID]
-			question := questionMap[answer.QuestionID]
-			// 初始化选项统计（确保每个选项的计数存在且为 0）
-			if _, initialized := optionCounts[question.ID]; !initialized {
-				counts := ensureMap(optionCounts, question.ID)
-				for _, option := range options {
-					counts[option.SerialNum] = 0
-				}
-			}
-			if question.QuestionType == 1 {
-				answerOptions := strings.Split(answer.Content, "┋")
-				questionOptions := optionAnswerMap[answer.QuestionID]
-				for _, answerOption := range answerOptions {
-					// 查找选项
-					if questionOptions != nil {
-						option, exists := questionOptions[answerOption]
-						if exists {
-							// 如果找到选项，处理逻辑
-							ensureMap(optionCounts, answer.QuestionID)[option.SerialNum]++
-							continue
-						}
-					}
-					// 如果选项不存在，处理为 "其他" 选项
-					ensureMap(optionCounts, answer.QuestionID)[0]++
-				}
-			}
-		}
-	}
-
-	response := make([]getSurveyStatisticsResponse, 0, len(optionCounts))
-	for qid, options := range optionCounts {
-		q := questionMap[qid]
-		var qOptions []getOptionCount
+		counts := optionCounts.Options[q.ID]
+		qOptions := make([]getOptionCount, 0, len(options)+1)
+		// 如果支持 "其他" 选项，添加一项
 		if q.OtherOption {
-			qOptions = make([]getOptionCount, 0, len(options)+1)
-			// 添加其他选项
 			qOptions = append(qOptions, getOptionCount{
 				SerialNum: 0,
 				Content:   "其他",
-				Count:     options[0],
+				Count:     counts[0],
 			})
-		} else {
-			qOptions = make([]getOptionCount, 0, len(options))
-		}
-		// 按序号排序
-		sortedSerialNums := make([]int, 0, len(options))
-		for oSerialNum := range options {
-			sortedSerialNums = append(sortedSerialNums, oSerialNum)
 		}
-		sort.Ints(sortedSerialNums)
-		for _, oSerialNum := range sortedSerialNums {
-			count := options[oSerialNum]
-			op := optionSerialNumMap[qid][oSerialNum]
+		for _, option := range options {
 			qOptions = append(qOptions, getOptionCount{
-				SerialNum: op.SerialNum,
-				Content:   op.Content,
-				Count:     count,
+				SerialNum: option.SerialNum,
+				Content:   option.Content,
+				Count:     counts[option.SerialNum],
 			})
 		}
 
@@ -579,24 +1077,87 @@ func GetSurveyStatistics(c *gin.Context) {
 			rankMap[sortedQOptions[i].SerialNum] = currentRank
 		}
 
-		// 将排名写回原始的 qOptions
+		// 将排名写回原始的 qOptions, 设置了只公开前N名时去掉排名靠后的选项
+		visibleOptions := make([]getOptionCount, 0, len(qOptions))
 		for i := range qOptions {
 			qOptions[i].Rank = rankMap[qOptions[i].SerialNum]
+			if survey.ResultTopN == 0 || qOptions[i].Rank <= int(survey.ResultTopN) {
+				visibleOptions = append(visibleOptions, qOptions[i])
+			}
 		}
 
 		response = append(response, getSurveyStatisticsResponse{
 			SerialNum:    q.SerialNum,
 			Question:     q.Subject,
 			QuestionType: q.QuestionType,
-			Options:      qOptions,
+			Options:      visibleOptions,
 		})
 	}
 	utils.JsonSuccessResponse(c, gin.H{"statistics": response})
 }
 
-func ensureMap(m map[int]map[int]int, key int) map[int]int {
-	if m[key] == nil {
-		m[key] = make(map[int]int)
+// liveHeartbeat 实时结果无更新时发送心跳的间隔, 防止连接被代理断开
+const liveHeartbeat = 15 * time.Second
+
+// GetLiveStatistics 通过 Server-Sent Events 推送投票问卷的实时计数
+func GetLiveStatistics(c *gin.Context) {
+	var data getSurveyStatisticsData
+	err := c.ShouldBindQuery(&data)
+	if err != nil {
+		code.AbortWithException(c, code.ParamError, err)
+		return
 	}
-	return m[key]
+	survey, err := service.GetSurveyByID(data.ID)
+	if err != nil {
+		code.AbortWithException(c, code.ServerError, err)
+		return
+	}
+	if survey.Type != 1 {
+		code.AbortWithException(c, code.SurveyTypeError, errors.New("问卷为调研问卷"))
+		return
+	}
+	// 判断投票结果是否对该填写者可见
+	if !checkResultVisibility(c, survey, data.Token) {
+		return
+	}
+	// 先订阅再获取当前计数, 避免遗漏两者之间的更新
+	pubsub := service.SubscribeLiveResults(c.Request.Context(), survey.ID)
+	defer func() {
+		if err := pubsub.Close(); err != nil {
+			zap.L().Error("Failed to close live results subscription", zap.Error(err))
+		}
+	}()
+	counts, err := service.GetVoteCounts(survey.ID)
+	if err != nil {
+		code.AbortWithException(c, code.ServerError, err)
+		return
+	}
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.SSEvent("statistics", service.LimitVoteCounts(survey, counts))
+	c.Writer.Flush()
+
+	messages := pubsub.Channel()
+	ticker := time.NewTicker(liveHeartbeat)
+	defer ticker.Stop()
+	c.Stream(func(_ io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case msg, ok := <-messages:
+			if !ok {
+				return false
+			}
+			var counts service.VoteCounts
+			if err := json.Unmarshal([]byte(msg.Payload), &counts); err != nil {
+				zap.L().Error("Failed to decode live results", zap.Error(err))
+				return true
+			}
+			c.SSEvent("statistics", service.LimitVoteCounts(survey, counts))
+			return true
+		case <-ticker.C:
+			c.SSEvent("ping", "")
+			return true
+		}
+	})
 }
@@ -0,0 +1,340 @@
+package user
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"QA-System/internal/dao"
+	"QA-System/internal/middleware"
+	"QA-System/internal/model"
+	"QA-System/internal/pkg/code"
+	database "QA-System/internal/pkg/database/mongodb"
+	"QA-System/internal/pkg/redis"
+	"QA-System/internal/pkg/utils"
+	"QA-System/internal/service"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	redisPkg "github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestRouter 使用内存 Redis、内存 SQLite 和模拟的 MongoDB 初始化服务, 返回注册了填写接口的路由
+func newTestRouter(t *testing.T, mdb *mongo.Database) (*gin.Engine, *gorm.DB) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redisPkg.NewClient(&redisPkg.Options{Addr: server.Addr()})
+	previous := redis.RedisClient
+	redis.RedisClient = client
+	t.Cleanup(func() {
+		redis.RedisClient = previous
+		_ = client.Close()
+	})
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 内存数据库只在同一连接内可见
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	err = db.AutoMigrate(&model.Survey{}, &model.Question{}, &model.Option{}, &model.Section{}, &model.Roster{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.Init(db, mdb)
+	database.QA, database.Record, database.Unique = "qa", "record", "unique"
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middleware.ErrHandler())
+	r.GET("/survey", GetSurvey)
+	r.POST("/survey", SubmitSurvey)
+	r.PUT("/draft", SaveDraft)
+	return r, db
+}
+
+// createSurvey 创建已发布的问卷, 包含一道必答题和两道题库题目, 每位填写者抽取一道题库题目
+func createSurvey(t *testing.T, db *gorm.DB, verify bool) int {
+	t.Helper()
+	survey := model.Survey{
+		Title:     "test",
+		Status:    2,
+		Verify:    verify,
+		DrawNum:   1,
+		StartTime: time.Now().Add(-time.Hour),
+		Deadline:  time.Now().Add(time.Hour),
+	}
+	if err := db.Create(&survey).Error; err != nil {
+		t.Fatal(err)
+	}
+	questions := []model.Question{
+		{SurveyID: survey.ID, SerialNum: 1, Subject: "name", QuestionType: 3, Required: true},
+		{SurveyID: survey.ID, SerialNum: 2, Subject: "bank a", QuestionType: 3, InBank: true},
+		{SurveyID: survey.ID, SerialNum: 3, Subject: "bank b", QuestionType: 3, InBank: true},
+	}
+	if err := db.Create(&questions).Error; err != nil {
+		t.Fatal(err)
+	}
+	return survey.ID
+}
+
+type testResponse struct {
+	Code int             `json:"code"`
+	Msg  string          `json:"msg"`
+	Data json.RawMessage `json:"data"`
+}
+
+// doRequest 发送请求并解析统一格式的响应
+func doRequest(t *testing.T, r *gin.Engine, method string, target string, body any) testResponse {
+	t.Helper()
+	var reader *bytes.Reader
+	if body != nil {
+		jsonData, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(jsonData)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req := httptest.NewRequest(method, target, reader)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("%s %s: status %d", method, target, w.Code)
+	}
+	var resp testResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("%s %s: %v", method, target, err)
+	}
+	return resp
+}
+
+type testSurvey struct {
+	ClientToken string `json:"client_token"`
+	QuesConfig  struct {
+		QuestionList []struct {
+			ID int `json:"id"`
+		} `json:"question_list"`
+	} `json:"ques_config"`
+	Draft *service.Draft `json:"draft"`
+}
+
+// getSurvey 获取问卷, 失败时终止测试
+func getSurvey(t *testing.T, r *gin.Engine, sid int, token string, clientToken string) testSurvey {
+	t.Helper()
+	query := url.Values{}
+	query.Set("id", strconv.Itoa(sid))
+	query.Set("token", token)
+	query.Set("client_token", clientToken)
+	resp := doRequest(t, r, http.MethodGet, "/survey?"+query.Encode(), nil)
+	if resp.Code != 200 {
+		t.Fatalf("GetSurvey() code = %d %s, want 200", resp.Code, resp.Msg)
+	}
+	var survey testSurvey
+	if err := json.Unmarshal(resp.Data, &survey); err != nil {
+		t.Fatal(err)
+	}
+	return survey
+}
+
+// answerAll 为获取到的每道题目填写答案
+func answerAll(survey testSurvey) []dao.QuestionsList {
+	answers := make([]dao.QuestionsList, 0, len(survey.QuesConfig.QuestionList))
+	for _, question := range survey.QuesConfig.QuestionList {
+		answers = append(answers, dao.QuestionsList{QuestionID: question.ID, Answer: "answer " + strconv.Itoa(question.ID)})
+	}
+	return answers
+}
+
+// insertedAnswerSheet 从模拟 MongoDB 的命令记录中取出保存的答卷
+func insertedAnswerSheet(mt *mtest.T) *dao.AnswerSheet {
+	for event := mt.GetStartedEvent(); event != nil; event = mt.GetStartedEvent() {
+		if event.CommandName != "insert" || event.Command.Lookup("insert").StringValue() != database.QA {
+			continue
+		}
+		var answerSheet dao.AnswerSheet
+		document := event.Command.Lookup("documents").Array().Index(0).Value().Document()
+		if err := bson.Unmarshal(document, &answerSheet); err != nil {
+			mt.Fatal(err)
+		}
+		return &answerSheet
+	}
+	return nil
+}
+
+func TestVerifiedSurveyDrawRoundTrip(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("submit drawn questions", func(mt *mtest.T) {
+		r, db := newTestRouter(mt.T, mt.DB)
+		sid := createSurvey(mt.T, db, true)
+		token := utils.NewJWT("name", "college", "202300000001", "本科生", "本科生", "男")
+
+		// 统一验证问卷不接受缺少或无效的统一验证令牌
+		for _, bad := range []string{"", "invalid"} {
+			query := "/survey?id=" + strconv.Itoa(sid) + "&client_token=client&token=" + bad
+			if resp := doRequest(mt.T, r, http.MethodGet, query, nil); resp.Code != code.NotLogin.Code {
+				mt.Fatalf("GetSurvey(token=%q) code = %d, want %d", bad, resp.Code, code.NotLogin.Code)
+			}
+		}
+
+		survey := getSurvey(mt.T, r, sid, token, "client")
+		if len(survey.QuesConfig.QuestionList) != 2 {
+			mt.Fatalf("GetSurvey() returned %d questions, want 2", len(survey.QuesConfig.QuestionList))
+		}
+		// 再次获取问卷时抽题结果不变
+		again := getSurvey(mt.T, r, sid, token, "another client")
+		if again.QuesConfig.QuestionList[1].ID != survey.QuesConfig.QuestionList[1].ID {
+			mt.Fatal("GetSurvey() drew a different question for the same respondent")
+		}
+
+		// 保存答卷和授权记录
+		mt.AddMockResponses(mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse())
+		// 统一验证问卷以学号识别填写者, 提交时的客户端令牌与获取问卷时不同也能找到抽题结果
+		answers := answerAll(survey)
+		resp := doRequest(mt.T, r, http.MethodPost, "/survey", gin.H{
+			"id":             sid,
+			"token":          token,
+			"client_token":   "another client",
+			"questions_list": answers,
+		})
+		if resp.Code != 200 {
+			mt.Fatalf("SubmitSurvey() code = %d %s, want 200", resp.Code, resp.Msg)
+		}
+		answerSheet := insertedAnswerSheet(mt)
+		if answerSheet == nil {
+			mt.Fatal("SubmitSurvey() did not save the answer sheet")
+		}
+		// 获取问卷和提交时的填写者标识一致, 才能计算出填写用时
+		if answerSheet.Meta == nil || answerSheet.Meta.Duration < 1 {
+			mt.Errorf("saved submit meta %+v, want a known duration", answerSheet.Meta)
+		}
+		if len(answerSheet.Answers) != len(answers) {
+			mt.Fatalf("saved %d answers, want %d", len(answerSheet.Answers), len(answers))
+		}
+		for i, answer := range answerSheet.Answers {
+			if answer.QuestionID != answers[i].QuestionID {
+				mt.Errorf("saved answer %d for question %d, want %d", i, answer.QuestionID, answers[i].QuestionID)
+			}
+		}
+	})
+}
+
+func TestDraftRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		verify  bool
+		inserts int // 提交时写入 MongoDB 的次数
+	}{
+		{name: "verified survey", verify: true, inserts: 2},
+		// 未统一验证的问卷即使携带统一验证令牌也以客户端令牌识别填写者
+		{name: "unverified survey opened with a token", verify: false, inserts: 1},
+	}
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			r, db := newTestRouter(mt.T, mt.DB)
+			sid := createSurvey(mt.T, db, tt.verify)
+			token := utils.NewJWT("name", "college", "202300000001", "本科生", "本科生", "男")
+
+			survey := getSurvey(mt.T, r, sid, token, "")
+			if survey.Draft != nil {
+				mt.Fatal("GetSurvey() returned a draft before saving one")
+			}
+			answers := answerAll(survey)
+			resp := doRequest(mt.T, r, http.MethodPut, "/draft", gin.H{
+				"id":             sid,
+				"token":          token,
+				"client_token":   survey.ClientToken,
+				"questions_list": answers[:1],
+			})
+			if resp.Code != 200 {
+				mt.Fatalf("SaveDraft() code = %d %s, want 200", resp.Code, resp.Msg)
+			}
+
+			survey = getSurvey(mt.T, r, sid, token, survey.ClientToken)
+			if survey.Draft == nil || len(survey.Draft.QuestionsList) != 1 ||
+				survey.Draft.QuestionsList[0] != answers[0] {
+				mt.Fatalf("GetSurvey() draft = %+v, want the saved answers", survey.Draft)
+			}
+
+			for range tt.inserts {
+				mt.AddMockResponses(mtest.CreateSuccessResponse())
+			}
+			resp = doRequest(mt.T, r, http.MethodPost, "/survey", gin.H{
+				"id":             sid,
+				"token":          token,
+				"client_token":   survey.ClientToken,
+				"questions_list": answers,
+			})
+			if resp.Code != 200 {
+				mt.Fatalf("SubmitSurvey() code = %d %s, want 200", resp.Code, resp.Msg)
+			}
+
+			// 提交成功后草稿被清除
+			survey = getSurvey(mt.T, r, sid, token, survey.ClientToken)
+			if survey.Draft != nil {
+				mt.Fatalf("GetSurvey() draft = %+v after submitting, want nil", survey.Draft)
+			}
+		})
+	}
+}
+
+func TestAnonymousSurveyEditByReceipt(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("anonymous survey", func(mt *mtest.T) {
+		r, db := newTestRouter(mt.T, mt.DB)
+		sid := createSurvey(mt.T, db, true)
+		err := db.Model(&model.Survey{}).Where("id = ?", sid).
+			Updates(map[string]any{"anonymous": true, "allow_edit": true}).Error
+		if err != nil {
+			mt.Fatal(err)
+		}
+		token := utils.NewJWT("name", "college", "202300000001", "本科生", "本科生", "男")
+		answers := answerAll(getSurvey(mt.T, r, sid, token, ""))
+
+		// 保存答卷和匿名授权记录
+		mt.AddMockResponses(mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse())
+		resp := doRequest(mt.T, r, http.MethodPost, "/survey", gin.H{
+			"id":             sid,
+			"token":          token,
+			"questions_list": answers,
+		})
+		if resp.Code != 200 {
+			mt.Fatalf("SubmitSurvey() code = %d %s, want 200", resp.Code, resp.Msg)
+		}
+		// 匿名问卷的答卷不记录学号的 HMAC, 否则可对名单中的学号计算 HMAC 关联答卷
+		answerSheet := insertedAnswerSheet(mt)
+		if answerSheet == nil || answerSheet.StudentID != "" {
+			mt.Fatalf("SubmitSurvey() saved %+v, want an answer sheet without student ID", answerSheet)
+		}
+
+		// 没有回执时不能按学号查找要修改的答卷
+		resp = doRequest(mt.T, r, http.MethodPost, "/survey", gin.H{
+			"id":             sid,
+			"token":          token,
+			"edit":           true,
+			"questions_list": answers,
+		})
+		if resp.Code != code.ParamError.Code {
+			mt.Fatalf("SubmitSurvey(edit without receipt) code = %d %s, want %d", resp.Code, resp.Msg,
+				code.ParamError.Code)
+		}
+	})
+}
@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+// Invitation 问卷邀请模型
+type Invitation struct {
+	ID       int        `json:"id"`        // 邀请ID
+	SurveyID int        `json:"survey_id"` // 问卷ID
+	Token    string     `json:"token"`     // 邀请令牌
+	Name     string     `json:"name"`      // 受邀人姓名
+	Email    string     `json:"email"`     // 受邀人邮箱
+	Status   int        `json:"status"`    // 邀请状态 1:未使用 2:已使用 3:已撤销
+	UsedAt   *time.Time `json:"used_at"`   // 使用时间, 未使用时为空
+	AnswerID string     `json:"answer_id"` // 对应的答卷ID
+}
@@ -4,6 +4,7 @@ package model
 type Question struct {
 	ID            int    `json:"id"`
 	SurveyID      int    `json:"survey_id"`      // 问卷ID
+	SectionID     int    `json:"section_id"`     // 所属分页ID 0为不分页
 	SerialNum     int    `json:"serial_num"`     // 题目序号
 	Img           string `json:"img"`            // 图片
 	Subject       string `json:"subject"`        // 题目
@@ -11,8 +12,13 @@ type Question struct {
 	Required      bool   `json:"required"`       // 是否必填
 	Unique        bool   `json:"unique"`         // 是否唯一
 	OtherOption   bool   `json:"other_option"`   // 是否有其他选项
-	QuestionType  int    `json:"question_type"`  // 题目类型 调研问卷为1单选2多选3填空4简答5图片6文件。  投票问卷为1投票
+	QuestionType  int    `json:"question_type"`  // 题目类型 调研问卷和测验为1单选2多选3填空4简答5图片6文件。  投票问卷为1投票。  7为展示块, 无需作答
 	MaximumOption uint   `json:"maximum_option"` // 多选最多所选选项数 0为不限制
 	MinimumOption uint   `json:"minimum_option"` // 多选最少所选选项数 0为不限制
 	Reg           string `json:"reg"`            // 正则表达式
+	Shuffle       bool   `json:"shuffle"`        // 是否打乱选项顺序
+	InBank        bool   `json:"in_bank"`        // 是否为题库题目, 题库题目按问卷设置随机抽取
+	CorrectAnswer string `json:"correct_answer"` // 测验正确答案 选择题为选项内容, 填空题为可接受的答案, 多个以┋分隔
+	Points        uint   `json:"points"`         // 测验题目分值
+	Explanation   string `json:"explanation"`    // 测验答案解析
 }
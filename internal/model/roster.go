@@ -0,0 +1,12 @@
+package model
+
+// Roster 问卷名单模型
+type Roster struct {
+	ID       int `json:"id"`                                                   // 名单ID
+	SurveyID int `json:"survey_id" gorm:"index:idx_survey_student,priority:1"` // 问卷ID
+	// 名单类型 1:允许名单 2:禁止名单 3:应填名单(仅用于统计未填写人员) 4:权重名单
+	ListType  int    `json:"list_type"`
+	StudentID string `json:"student_id" gorm:"size:64;index:idx_survey_student,priority:2"` // 学号
+	Name      string `json:"name"`                                                          // 姓名
+	Weight    uint   `json:"weight"`                                                        // 加权计票时的票数权重, 仅权重名单使用
+}
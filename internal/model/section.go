@@ -0,0 +1,11 @@
+package model
+
+// Section 问卷分页模型
+type Section struct {
+	ID          int    `json:"id"`          // 分页ID
+	SurveyID    int    `json:"survey_id"`   // 问卷ID
+	SerialNum   int    `json:"serial_num"`  // 分页序号
+	Title       string `json:"title"`       // 分页标题
+	Description string `json:"description"` // 分页描述
+	Img         string `json:"img"`         // 分页图片
+}
@@ -4,18 +4,50 @@ import "time"
 
 // Survey 问卷模型
 type Survey struct {
-	ID         int       `json:"id"`         // 问卷id
-	UserID     int       `json:"user_id"`    // 用户id
-	Title      string    `json:"title"`      // 问卷标题
-	Desc       string    `json:"desc"`       // 问卷描述
-	StartTime  time.Time `json:"start_time"` // 开始时间
-	Deadline   time.Time `json:"deadline"`   // 截止时间
-	Status     int       `json:"status"`     // 问卷状态  1:未发布 2:已发布 3:已截止
-	DailyLimit uint      `json:"day_limit"`  // 问卷每日填写限制
-	SumLimit   uint      `json:"sum_limit"`  // 问卷总填写次数限制
-	Verify     bool      `json:"verify"`     // 问卷是否需要统一验证
-	Type       uint      `json:"type"`       // 问卷类型 0:调研 1:投票
-	Num        int       `json:"num"`        // 问卷填写数量
+	ID             int       `json:"id"`              // 问卷id
+	UserID         int       `json:"user_id"`         // 用户id
+	Title          string    `json:"title"`           // 问卷标题
+	Desc           string    `json:"desc"`            // 问卷描述
+	StartTime      time.Time `json:"start_time"`      // 开始时间
+	Deadline       time.Time `json:"deadline"`        // 截止时间
+	Status         int       `json:"status"`          // 问卷状态  1:未发布 2:已发布 3:已截止
+	DailyLimit     uint      `json:"day_limit"`       // 问卷每日填写限制
+	SumLimit       uint      `json:"sum_limit"`       // 问卷总填写次数限制
+	Verify         bool      `json:"verify"`          // 问卷是否需要统一验证
+	Type           uint      `json:"type"`            // 问卷类型 0:调研 1:投票 2:测验
+	Num            int       `json:"num"`             // 问卷填写数量
+	MaxNum         uint      `json:"max_num"`         // 问卷最大填写数量 0为不限制, 达到上限后问卷自动截止
+	Shuffle        bool      `json:"shuffle"`         // 是否打乱题目顺序
+	DrawNum        uint      `json:"draw_num"`        // 每位填写者从题库中抽取的题目数 0为不抽题
+	ShowScore      bool      `json:"show_score"`      // 测验提交后是否向填写者展示得分和解析
+	AllowEdit      bool      `json:"allow_edit"`      // 问卷截止前是否允许填写者修改已提交的答卷
+	Anonymous      bool      `json:"anonymous"`       // 统一验证问卷是否匿名, 匿名时不保存可与答卷关联的身份信息
+	AccessCode     string    `json:"access_code"`     // 问卷访问码 空为不需要
+	InviteOnly     bool      `json:"invite_only"`     // 是否仅允许持有邀请链接的人填写, 每个邀请只能提交一次
+	ProofOfWork    bool      `json:"proof_of_work"`   // 提交时是否需要完成工作量证明
+	IPLimit        uint      `json:"ip_limit"`        // 每个IP每日提交次数限制 0为不限制
+	DeviceLimit    uint      `json:"device_limit"`    // 每台设备每日提交次数限制 0为不限制
+	UniqueMode     uint      `json:"unique_mode"`     // 唯一问题答案重复时的处理方式 0:拒绝提交 1:保留最新答卷
+	ResultVisible  uint      `json:"result_visible"`  // 投票结果可见范围 0:公开 1:截止后公开 2:仅已投票者 3:仅管理员
+	ResultTopN     uint      `json:"result_top_n"`    // 投票结果每题只公开排名前N的选项 0为全部公开
+	ReceiptAnswers bool      `json:"receipt_answers"` // 凭提交回执是否可查看已提交的答案
+	// 统一验证问卷的填写资格, 多个以┋分隔 空为不限制
+	EligibleUserTypes     string `json:"eligible_user_types"`      // 允许填写的用户类型, 如本科生、研究生
+	EligibleColleges      string `json:"eligible_colleges"`        // 允许填写的学院
+	EligibleGenders       string `json:"eligible_genders"`         // 允许填写的性别
+	EligibleStuIDPrefixes string `json:"eligible_stu_id_prefixes"` // 允许填写的学号前缀, 可用于限制年级
+
+	CreatedAt time.Time `json:"created_at"` // 创建时间
+}
+
+// IsFull 问卷填写数量是否已达上限
+func (s *Survey) IsFull() bool {
+	return s.MaxNum > 0 && s.Num >= int(s.MaxNum)
+}
+
+// IsEditable 问卷当前是否允许修改已提交的答卷
+func (s *Survey) IsEditable() bool {
+	return s.AllowEdit && s.Status == 2 && (s.Deadline.IsZero() || s.Deadline.After(time.Now()))
 }
 
 // SurveyResp 问卷响应模型
@@ -51,8 +51,31 @@ var (
 	StatusRepeatError            = NewError(200529, log.LevelInfo, "问卷状态重复，请重新选择")
 	AnswerSheetNotExist          = NewError(200530, log.LevelInfo, "答卷不存在,请重新选择")
 	VoteSumLimitError            = NewError(200531, log.LevelInfo, "总投票次数已达上限")
-	NotUnderGraduateError        = NewError(200532, log.LevelInfo, "当前问卷仅允许本科生提交")
+	UserTypeIneligibleError      = NewError(200532, log.LevelInfo, "当前问卷不对您的身份类型开放")
 	WrongOauthUsernameOrPassword = NewError(200534, log.LevelInfo, "统一登录账号或密码错误")
+	SurveyFullError              = NewError(200535, log.LevelInfo, "问卷填写人数已达上限，感谢您的关注")
+	DrawNotFound                 = NewError(200536, log.LevelInfo, "抽题记录不存在，请重新获取问卷")
+	EditNotAllowed               = NewError(200537, log.LevelInfo, "该问卷不允许修改已提交的答卷")
+	ReceiptInvalid               = NewError(200538, log.LevelInfo, "提交回执无效")
+	CollegeIneligibleError       = NewError(200539, log.LevelInfo, "当前问卷不对您所在的学院开放")
+	GenderIneligibleError        = NewError(200540, log.LevelInfo, "当前问卷不对您的性别开放")
+	StudentIDIneligibleError     = NewError(200541, log.LevelInfo, "当前问卷不对您的年级或学号开放")
+	NotInRosterError             = NewError(200542, log.LevelInfo, "您不在该问卷的填写名单中")
+	RosterDeniedError            = NewError(200543, log.LevelInfo, "您已被限制填写该问卷")
+	RosterFileError              = NewError(200544, log.LevelInfo, "名单文件格式错误，仅支持 xlsx 或 csv 文件")
+	AnonymousSurveyError         = NewError(200545, log.LevelInfo, "匿名问卷不支持按身份信息统计")
+	AccessCodeError              = NewError(200546, log.LevelInfo, "访问码错误")
+	AccessAttemptLimitError      = NewError(200547, log.LevelInfo, "访问码尝试次数过多，请稍后再试")
+	AccessTokenError             = NewError(200548, log.LevelInfo, "请输入访问码后再访问问卷")
+	InvitationInvalidError       = NewError(200549, log.LevelInfo, "邀请链接无效或已被撤销")
+	InvitationUsedError          = NewError(200550, log.LevelInfo, "邀请链接已被使用")
+	ChallengeError               = NewError(200551, log.LevelInfo, "人机验证失败，请刷新页面后重试")
+	IPLimitError                 = NewError(200552, log.LevelInfo, "当前网络今日提交次数已达上限")
+	DeviceLimitError             = NewError(200553, log.LevelInfo, "当前设备今日提交次数已达上限")
+	ResultHiddenError            = NewError(200554, log.LevelInfo, "投票结果暂未公开")
+	ResultNotVotedError          = NewError(200555, log.LevelInfo, "投票后才能查看结果")
+	WeightedVoteError            = NewError(200556, log.LevelInfo, "加权计票仅支持统一验证问卷")
+	CursorError                  = NewError(200557, log.LevelInfo, "分页游标无效")
 	NotFound                     = NewError(200404, log.LevelInfo, http.StatusText(http.StatusNotFound))
 )
 
@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"QA-System/internal/global/config"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
@@ -17,6 +18,9 @@ var QA string
 // Record mongodb存储记录的集合名
 var Record string
 
+// Unique mongodb存储唯一问题答案的集合名
+var Unique string
+
 // Init 初始化 MongoDB 连接
 func Init() *mongo.Database {
 	// Get MongoDB connection information from the configuration file
@@ -27,6 +31,9 @@ func Init() *mongo.Database {
 	db := config.Config.GetString("mongodb.db")
 	QA = config.Config.GetString("mongodb.qa-collection")
 	Record = config.Config.GetString("mongodb.record-collection")
+	// 早于唯一问题答案集合的配置文件中没有该项
+	config.Config.SetDefault("mongodb.unique-collection", "unique")
+	Unique = config.Config.GetString("mongodb.unique-collection")
 
 	// 构建 MongoDB 连接字符串
 	dsn := fmt.Sprintf("mongodb://%v:%v@%v:%v/%v", user, pass, host, port, db)
@@ -44,6 +51,26 @@ func Init() *mongo.Database {
 
 	mdb := client.Database(db)
 
+	// 按问卷分页查询答卷时以答卷ID作为游标
+	_, err = mdb.Collection(QA).Indexes().CreateOne(context.TODO(), mongo.IndexModel{
+		Keys: bson.D{{Key: "surveyid", Value: 1}, {Key: "_id", Value: 1}},
+	})
+	if err != nil {
+		zap.L().Fatal("Failed to create MongoDB index:" + err.Error())
+	}
+
+	// 唯一问题的答案在同一问卷的同一问题中不可重复
+	_, err = mdb.Collection(Unique).Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "surveyid", Value: 1}, {Key: "questionid", Value: 1}, {Key: "value", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "answerid", Value: 1}}},
+	})
+	if err != nil {
+		zap.L().Fatal("Failed to create MongoDB index:" + err.Error())
+	}
+
 	// 日志记录
 	zap.L().Info("Connected to MongoDB")
 	return mdb
@@ -5,13 +5,45 @@ import (
 	"gorm.io/gorm"
 )
 
+// columnBackfill 新增字段后为已有数据填充的值, 仅在字段首次创建时执行
+type columnBackfill struct {
+	model any
+	field string
+	sql   string
+}
+
+var columnBackfills = []columnBackfill{
+	// 填写资格上线前统一验证问卷仅允许本科生填写
+	{&model.Survey{}, "EligibleUserTypes", "UPDATE surveys SET eligible_user_types = '本科生' WHERE verify = true"},
+	// 创建时间上线前的问卷以开始时间作为创建时间, 保证按创建时间分页时不会遗漏
+	{&model.Survey{}, "CreatedAt", "UPDATE surveys SET created_at = COALESCE(start_time, NOW()) WHERE created_at IS NULL"},
+}
+
 func autoMigrate(db *gorm.DB) error {
-	return db.AutoMigrate(
+	pending := make([]columnBackfill, 0, len(columnBackfills))
+	for _, backfill := range columnBackfills {
+		if !db.Migrator().HasColumn(backfill.model, backfill.field) {
+			pending = append(pending, backfill)
+		}
+	}
+	err := db.AutoMigrate(
 		&model.User{},
 		&model.Survey{},
 		&model.Question{},
+		&model.Section{},
+		&model.Roster{},
+		&model.Invitation{},
 		&model.Option{},
 		&model.Manage{},
 		&model.Pre{},
 	)
+	if err != nil {
+		return err
+	}
+	for _, backfill := range pending {
+		if err := db.Exec(backfill.sql).Error; err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -75,3 +75,83 @@ func ParseJWT(token string) (oauth.UserInfo, error) {
 	}
 	return userInfo, nil
 }
+
+// NewReceiptJWT 生成提交回执令牌, 回执在 duration 后过期
+func NewReceiptJWT(sid int, answerID string, duration time.Duration) string {
+	key := global.Config.GetString("jwt.key")
+	t := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"type":     "receipt",
+		"sid":      sid,
+		"answerId": answerID,
+		"exp":      time.Now().Add(duration).Unix(),
+	})
+	s, err := t.SignedString([]byte(key))
+	if err != nil {
+		return ""
+	}
+	return s
+}
+
+// ParseReceiptJWT 解析提交回执令牌, 返回问卷ID和答卷ID
+func ParseReceiptJWT(token string) (int, string, error) {
+	key := global.Config.GetString("jwt.key")
+	t, err := jwt.Parse(token, func(_ *jwt.Token) (any, error) {
+		return []byte(key), nil
+	}, jwt.WithExpirationRequired())
+	if err != nil {
+		return 0, "", err
+	}
+	claims, ok := t.Claims.(jwt.MapClaims)
+	if !ok || !t.Valid || claims["type"] != "receipt" {
+		return 0, "", errors.New("invalid receipt")
+	}
+	sid, ok := claims["sid"].(float64)
+	if !ok {
+		return 0, "", errors.New("invalid receipt")
+	}
+	answerID, ok := claims["answerId"].(string)
+	if !ok {
+		return 0, "", errors.New("invalid receipt")
+	}
+	return int(sid), answerID, nil
+}
+
+// NewAccessJWT 生成问卷访问令牌, version 用于在访问码更换后使旧令牌失效
+func NewAccessJWT(sid int, version string, duration time.Duration) string {
+	key := global.Config.GetString("jwt.key")
+	t := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"type":    "access",
+		"sid":     sid,
+		"version": version,
+		"exp":     time.Now().Add(duration).Unix(),
+	})
+	s, err := t.SignedString([]byte(key))
+	if err != nil {
+		return ""
+	}
+	return s
+}
+
+// ParseAccessJWT 解析问卷访问令牌, 返回问卷ID和访问码版本
+func ParseAccessJWT(token string) (int, string, error) {
+	key := global.Config.GetString("jwt.key")
+	t, err := jwt.Parse(token, func(_ *jwt.Token) (any, error) {
+		return []byte(key), nil
+	})
+	if err != nil {
+		return 0, "", err
+	}
+	claims, ok := t.Claims.(jwt.MapClaims)
+	if !ok || !t.Valid || claims["type"] != "access" {
+		return 0, "", errors.New("invalid access token")
+	}
+	sid, ok := claims["sid"].(float64)
+	if !ok {
+		return 0, "", errors.New("invalid access token")
+	}
+	version, ok := claims["version"].(string)
+	if !ok {
+		return 0, "", errors.New("invalid access token")
+	}
+	return int(sid), version, nil
+}
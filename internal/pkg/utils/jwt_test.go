@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	global "QA-System/internal/global/config"
+)
+
+func TestReceiptJWT(t *testing.T) {
+	global.Config.Set("jwt.key", "test-key")
+
+	// 并发生成的回执互不影响
+	var wg sync.WaitGroup
+	for i := 1; i <= 20; i++ {
+		wg.Add(1)
+		go func(sid int) {
+			defer wg.Done()
+			token := NewReceiptJWT(sid, "answer", time.Hour)
+			got, answerID, err := ParseReceiptJWT(token)
+			if err != nil || got != sid || answerID != "answer" {
+				t.Errorf("ParseReceiptJWT() = %d, %q, %v, want %d, %q, nil", got, answerID, err, sid, "answer")
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if _, _, err := ParseReceiptJWT(NewReceiptJWT(1, "answer", -time.Minute)); err == nil {
+		t.Error("ParseReceiptJWT() accepted an expired receipt")
+	}
+}
@@ -19,7 +19,12 @@ func Init(r *gin.Engine) {
 		{
 			user.POST("/submit", u.SubmitSurvey)
 			user.GET("/get", u.GetSurvey)
+			user.POST("/draft", u.SaveDraft)
+			user.POST("/access", u.ExchangeAccessCode)
+			user.GET("/submission", u.GetSubmission)
+			user.GET("/receipt", u.VerifyReceipt)
 			user.GET("/statistic", u.GetSurveyStatistics)
+			user.GET("/statistic/live", u.GetLiveStatistics)
 			user.POST("/upload/img", u.UploadImg)
 			user.POST("/upload/file", u.UploadFile)
 			user.POST("/oauth", u.Oauth)
@@ -33,8 +38,12 @@ func Init(r *gin.Engine) {
 			admin.POST("/new", a.CreateQuestionPre)
 			admin.PUT("/update/status", a.UpdateSurveyStatus)
 			admin.PUT("/update/questions", a.UpdateSurvey)
+			admin.PUT("/update/access_code", a.UpdateAccessCode)
 			admin.GET("/list/answers", a.GetSurveyAnswers)
 			admin.GET("/statics/answers", a.GetSurveyStatistics)
+			admin.GET("/statics/score", a.GetQuizStatistics)
+			admin.POST("/statics/rebuild", a.RebuildVoteCounts)
+			admin.GET("/statics/tally", a.GetVoteTally)
 			admin.DELETE("/delete", a.DeleteSurvey)
 			admin.DELETE("/delete/answersheet", a.DeleteAnswerSheet)
 
@@ -44,6 +53,18 @@ func Init(r *gin.Engine) {
 			admin.GET("/list/questions", a.GetAllSurvey)
 			admin.GET("/single/question", a.GetSurvey)
 			admin.GET("/download", a.DownloadFile)
+
+			admin.POST("/roster/import", a.ImportRoster)
+			admin.DELETE("/roster/delete", a.DeleteRoster)
+			admin.GET("/roster/report", a.GetRosterReport)
+			admin.GET("/roster/export", a.ExportRosterReport)
+
+			admin.POST("/invitation/import", a.ImportInvitations)
+			admin.GET("/invitation/list", a.GetInvitations)
+			admin.PUT("/invitation/revoke", a.RevokeInvitation)
+
+			admin.GET("/fraud/report", a.GetFraudReport)
+			admin.PUT("/fraud/mark", a.MarkAnswerSheets)
 		}
 	}
 }
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"time"
+
+	"QA-System/internal/model"
+	"QA-System/internal/pkg/code"
+	"QA-System/internal/pkg/redis"
+	"QA-System/internal/pkg/utils"
+)
+
+const (
+	// accessTokenExpiration 访问令牌有效期
+	accessTokenExpiration = 2 * time.Hour
+	// accessAttemptLimit 访问码尝试次数上限
+	accessAttemptLimit = 5
+	// accessAttemptWindow 访问码尝试次数统计窗口
+	accessAttemptWindow = 10 * time.Minute
+)
+
+func accessAttemptKey(sid int, ip string) string {
+	return fmt.Sprintf("survey:%d:access_attempts:%s", sid, ip)
+}
+
+// accessCodeVersion 计算访问码的版本标识, 访问码更换后旧的访问令牌随之失效
+func accessCodeVersion(accessCode string) string {
+	sum := sha256.Sum256([]byte(accessCode))
+	return hex.EncodeToString(sum[:8])
+}
+
+// ExchangeAccessCode 校验访问码并换取访问令牌, 同一IP在统计窗口内尝试次数过多时拒绝校验
+func ExchangeAccessCode(survey *model.Survey, accessCode string, ip string) (string, error) {
+	key := accessAttemptKey(survey.ID, ip)
+	attempts, err := redis.RedisClient.Incr(ctx, key).Result()
+	if err != nil {
+		return "", err
+	}
+	if attempts == 1 {
+		if err := redis.RedisClient.Expire(ctx, key, accessAttemptWindow).Err(); err != nil {
+			return "", err
+		}
+	}
+	if attempts > accessAttemptLimit {
+		return "", code.AccessAttemptLimitError
+	}
+	if subtle.ConstantTimeCompare([]byte(accessCode), []byte(survey.AccessCode)) != 1 {
+		return "", code.AccessCodeError
+	}
+	if err := redis.RedisClient.Del(ctx, key).Err(); err != nil {
+		return "", err
+	}
+	return utils.NewAccessJWT(survey.ID, accessCodeVersion(survey.AccessCode), accessTokenExpiration), nil
+}
+
+// CheckAccessToken 判断访问令牌是否有效, 未设置访问码的问卷无需令牌
+func CheckAccessToken(survey *model.Survey, token string) bool {
+	if survey.AccessCode == "" {
+		return true
+	}
+	sid, version, err := utils.ParseAccessJWT(token)
+	if err != nil {
+		return false
+	}
+	return sid == survey.ID && version == accessCodeVersion(survey.AccessCode)
+}
+
+// RotateAccessCode 更换问卷访问码, 访问码为空时随机生成六位数字, 返回新的访问码
+func RotateAccessCode(sid int, accessCode string) (string, error) {
+	if accessCode == "" {
+		n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+		if err != nil {
+			return "", err
+		}
+		accessCode = fmt.Sprintf("%06d", n.Int64())
+	}
+	return accessCode, d.UpdateSurveyAccessCode(ctx, sid, accessCode)
+}
+
+// ClearAccessCode 取消问卷访问码
+func ClearAccessCode(sid int) error {
+	return d.UpdateSurveyAccessCode(ctx, sid, "")
+}
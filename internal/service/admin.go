@@ -1,16 +1,18 @@
 package service
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
-	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"QA-System/internal/dao"
 	"QA-System/internal/model"
+	"QA-System/internal/pkg/code"
 	"QA-System/internal/pkg/utils"
 	"github.com/xuri/excelize/v2"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -78,24 +80,22 @@ func CheckPermission(id int, surveyID int) error {
 }
 
 // CreateSurvey 创建问卷
-func CreateSurvey(id int, question_list []dao.QuestionList, status int, surveyType, limit uint,
-	sumLimit uint, verify bool, ddl, startTime time.Time, title string, desc string) error {
+func CreateSurvey(id int, sections []dao.SectionList, question_list []dao.QuestionList, status int, surveyType uint,
+	config dao.BaseConfig, ddl, startTime time.Time, title string, desc string) error {
 	var survey model.Survey
 	survey.UserID = id
 	survey.Status = status
 	survey.Deadline = ddl
 	survey.Type = surveyType
-	survey.DailyLimit = limit
-	survey.SumLimit = sumLimit
-	survey.Verify = verify
 	survey.StartTime = startTime
 	survey.Title = title
 	survey.Desc = desc
+	applyBaseConfig(&survey, config)
 	survey, err := d.CreateSurvey(ctx, survey)
 	if err != nil {
 		return err
 	}
-	_, err = createQuestionsAndOptions(question_list, survey.ID)
+	_, err = createQuestionsAndOptions(sections, question_list, survey.ID)
 	return err
 }
 
@@ -106,8 +106,8 @@ func UpdateSurveyStatus(id int, status int) error {
 }
 
 // UpdateSurvey 更新问卷
-func UpdateSurvey(id int, question_list []dao.QuestionList, surveyType,
-	limit uint, sumLimit uint, verify bool, desc string, title string, ddl, startTime time.Time) error {
+func UpdateSurvey(id int, sections []dao.SectionList, question_list []dao.QuestionList, surveyType uint,
+	config dao.BaseConfig, desc string, title string, ddl, startTime time.Time) error {
 	// 遍历原有问题，删除对应选项
 	var oldQuestions []model.Question
 	var old_imgs []string
@@ -121,6 +121,16 @@ func UpdateSurvey(id int, question_list []dao.QuestionList, surveyType,
 	if err != nil {
 		return err
 	}
+	sectionImgs, err := getSectionImgs(id)
+	if err != nil {
+		return err
+	}
+	old_imgs = append(old_imgs, sectionImgs...)
+	// 删除原有分页
+	err = d.DeleteSectionsBySurveyID(ctx, id)
+	if err != nil {
+		return err
+	}
 	// 删除原有问题和选项
 	for _, oldQuestion := range oldQuestions {
 		oldOptions, err := d.GetOptionsByQuestionID(ctx, oldQuestion.ID)
@@ -147,16 +157,30 @@ func UpdateSurvey(id int, question_list []dao.QuestionList, surveyType,
 		}
 	}
 	// 修改问卷信息
-	err = d.UpdateSurvey(ctx, id, surveyType, limit, sumLimit, verify, desc, title, ddl, startTime)
+	survey := model.Survey{
+		ID:        id,
+		Type:      surveyType,
+		Desc:      desc,
+		Title:     title,
+		Deadline:  ddl,
+		StartTime: startTime,
+	}
+	applyBaseConfig(&survey, config)
+	err = d.UpdateSurvey(ctx, survey)
 	if err != nil {
 		return err
 	}
 	// 重新添加问题和选项
-	imgs, err := createQuestionsAndOptions(question_list, id)
+	imgs, err := createQuestionsAndOptions(sections, question_list, id)
 	if err != nil {
 		return err
 	}
 	new_imgs = append(new_imgs, imgs...)
+	// 问题重建后原有计数失效
+	err = ResetVoteCounts(id)
+	if err != nil {
+		return err
+	}
 	urlHost := GetConfigUrl()
 	// 删除无用图片
 	for _, oldImg := range old_imgs {
@@ -170,6 +194,29 @@ func UpdateSurvey(id int, question_list []dao.QuestionList, surveyType,
 	return nil
 }
 
+// applyBaseConfig 将基本配置写入问卷模型
+func applyBaseConfig(survey *model.Survey, config dao.BaseConfig) {
+	survey.DailyLimit = config.DailyLimit
+	survey.SumLimit = config.SumLimit
+	survey.Verify = config.Verify
+	survey.MaxNum = config.MaxNum
+	survey.Shuffle = config.Shuffle
+	survey.DrawNum = config.DrawNum
+	survey.ShowScore = config.ShowScore
+	survey.AllowEdit = config.AllowEdit
+	survey.Anonymous = config.Anonymous
+	survey.AccessCode = config.AccessCode
+	survey.InviteOnly = config.InviteOnly
+	survey.ProofOfWork = config.ProofOfWork
+	survey.IPLimit = config.IPLimit
+	survey.DeviceLimit = config.DeviceLimit
+	survey.UniqueMode = config.UniqueMode
+	survey.ResultVisible = config.ResultVisible
+	survey.ResultTopN = config.ResultTopN
+	survey.ReceiptAnswers = config.ReceiptAnswers
+	applyEligibility(survey, config.Eligibility)
+}
+
 // UserInManage 用户是否在管理中
 func UserInManage(uid int, sid int) bool {
 	_, err := d.GetManageByUIDAndSID(ctx, uid, sid)
@@ -184,7 +231,7 @@ func DeleteSurvey(id int) error {
 		return err
 	}
 	var answerSheets []dao.AnswerSheet
-	answerSheets, _, err = d.GetAnswerSheetBySurveyID(ctx, id, 0, 0, "", false)
+	answerSheets, err = d.GetAnswerSheetBySurveyID(ctx, id, dao.AnswerFilter{}, dao.AnswerPage{})
 	if err != nil {
 		return err
 	}
@@ -193,6 +240,11 @@ func DeleteSurvey(id int) error {
 	if err != nil {
 		return err
 	}
+	sectionImgs, err := getSectionImgs(id)
+	if err != nil {
+		return err
+	}
+	imgs = append(imgs, sectionImgs...)
 	// 删除文件
 	files, err := getDelFiles(answerSheets)
 	if err != nil {
@@ -227,6 +279,10 @@ func DeleteSurvey(id int) error {
 	if err != nil {
 		return err
 	}
+	err = d.DeleteSectionsBySurveyID(ctx, id)
+	if err != nil {
+		return err
+	}
 	err = dao.DeleteAllQuestionCache(ctx)
 	if err != nil {
 		return err
@@ -240,21 +296,37 @@ func DeleteSurvey(id int) error {
 		return err
 	}
 	err = d.DeleteManageBySurveyID(ctx, id)
+	if err != nil {
+		return err
+	}
+	err = d.DeleteRostersBySurveyID(ctx, id)
+	if err != nil {
+		return err
+	}
+	err = d.DeleteInvitationsBySurveyID(ctx, id)
 	return err
 }
 
-// GetSurveyAnswers 获取问卷答案
-func GetSurveyAnswers(id int, num int, size int, text string, unique bool) (dao.AnswersResonse, *int64, error) {
+// GetSurveyAnswers 分页获取问卷答案, cursor 为上一页返回的游标, 返回答案、符合条件的答卷总数和下一页的游标
+func GetSurveyAnswers(id int, filter dao.AnswerFilter, page dao.AnswerPage, cursor string) (
+	dao.AnswersResonse, int64, string, error) {
 	var answerSheets []dao.AnswerSheet
 	data := make([]dao.QuestionAnswers, 0)
 	times := make([]string, 0)
 	aids := make([]primitive.ObjectID, 0)
-	var total *int64
-	// 获取问题
+	if cursor != "" {
+		after, err := primitive.ObjectIDFromHex(cursor)
+		if err != nil {
+			return dao.AnswersResonse{}, 0, "", code.CursorError
+		}
+		page.After = after
+	}
+	// 获取问题, 展示块不计入答案
 	questions, err := d.GetQuestionsBySurveyID(ctx, id)
 	if err != nil {
-		return dao.AnswersResonse{}, nil, err
+		return dao.AnswersResonse{}, 0, "", err
 	}
+	questions = AnswerableQuestions(questions)
 	// 初始化data
 	for _, question := range questions {
 		var q dao.QuestionAnswers
@@ -264,97 +336,129 @@ func GetSurveyAnswers(id int, num int, size int, text string, unique bool) (dao.
 		data = append(data, q)
 	}
 	// 获取答卷
-	answerSheets, total, err = d.GetAnswerSheetBySurveyID(ctx, id, num, size, text, unique)
+	total, err := d.CountAnswerSheets(ctx, id, filter)
 	if err != nil {
-		return dao.AnswersResonse{}, nil, err
+		return dao.AnswersResonse{}, 0, "", err
+	}
+	answerSheets, err = d.GetAnswerSheetBySurveyID(ctx, id, filter, page)
+	if err != nil {
+		return dao.AnswersResonse{}, 0, "", err
 	}
 	// 填充data
 	for _, answerSheet := range answerSheets {
 		times = append(times, answerSheet.Time)
 		aids = append(aids, answerSheet.AnswerID)
-		for _, answer := range answerSheet.Answers {
-			question, err := d.GetQuestionByID(ctx, answer.QuestionID)
-			if err != nil {
-				return dao.AnswersResonse{}, nil, err
-			}
-			for i, q := range data {
-				if q.Title == question.Subject {
-					data[i].Answers = append(data[i].Answers, answer.Content)
-				}
-			}
-		}
+		fillAnswers(data, questions, answerSheet)
+	}
+	next := ""
+	if len(answerSheets) > 0 && int64(len(answerSheets)) == page.Limit {
+		next = answerSheets[len(answerSheets)-1].AnswerID.Hex()
 	}
-	return dao.AnswersResonse{QuestionAnswers: data, AnswerIDs: aids, Time: times}, total, nil
+	return dao.AnswersResonse{QuestionAnswers: data, AnswerIDs: aids, Time: times}, total, next, nil
 }
 
-// GetSurveyByUserID 获取用户的所有问卷
-func GetSurveyByUserID(userId int) ([]model.Survey, error) {
-	return d.GetSurveyByUserID(ctx, userId)
+// surveyCursor 问卷列表游标的编码内容, 排序方式变化后游标失效
+type surveyCursor struct {
+	Sort  string          `json:"s"`
+	Desc  bool            `json:"d"`
+	Value json.RawMessage `json:"v"`
+	ID    int             `json:"id"`
 }
 
-// ProcessResponse 处理响应
-func ProcessResponse(response []model.SurveyResp, pageNum, pageSize int, title string) ([]model.SurveyResp, int) {
-	resp := response
-	if title != "" {
-		filteredResponse := make([]model.SurveyResp, 0)
-		for _, item := range response {
-			if strings.Contains(strings.ToLower(item.Title), strings.ToLower(title)) {
-				filteredResponse = append(filteredResponse, item)
-			}
+// ListSurveys 按条件分页查询问卷列表, cursor 为上一页返回的游标, 返回问卷、总数和下一页的游标
+func ListSurveys(filter dao.SurveyFilter, cursor string) ([]model.SurveyResp, int64, string, error) {
+	filter.Now = time.Now()
+	if cursor != "" {
+		after, err := decodeSurveyCursor(cursor, filter)
+		if err != nil {
+			return nil, 0, "", err
 		}
-		resp = filteredResponse
+		filter.After = after
 	}
-
-	num := len(resp)
-	if pageNum < 1 {
-		pageNum = 1
-	}
-	if pageSize < 1 {
-		pageSize = 10 // 默认的页大小
+	surveys, total, err := d.ListSurveys(ctx, filter)
+	if err != nil {
+		return nil, 0, "", err
 	}
-	startIdx := (pageNum - 1) * pageSize
-	endIdx := startIdx + pageSize
-	if startIdx > len(resp) {
-		return []model.SurveyResp{}, num // 如果起始索引超出范围，返回空数据
+	next := ""
+	if len(surveys) > 0 && len(surveys) == filter.Limit {
+		next, err = encodeSurveyCursor(surveys[len(surveys)-1], filter)
+		if err != nil {
+			return nil, 0, "", err
+		}
 	}
-	if endIdx > len(resp) {
-		endIdx = len(resp)
+	for i := range surveys {
+		if surveys[i].Deadline.Before(filter.Now) {
+			surveys[i].Status = 3
+		}
 	}
-	pagedResponse := resp[startIdx:endIdx]
-
-	return pagedResponse, num
+	return GetSurveyResponse(surveys), total, next, nil
 }
 
-// GetAllSurvey 获取所有问卷
-func GetAllSurvey() ([]model.Survey, error) {
-	return d.GetAllSurvey(ctx)
+// surveySortValue 获取问卷在排序字段上的值, 与 dao 中的排序表达式保持一致
+func surveySortValue(survey model.Survey, filter dao.SurveyFilter) any {
+	switch filter.Sort {
+	case dao.SurveySortCreated:
+		return survey.CreatedAt
+	case dao.SurveySortDeadline:
+		return survey.Deadline
+	case dao.SurveySortNum:
+		return survey.Num
+	case dao.SurveySortTitle:
+		return survey.Title
+	case dao.SurveySortID:
+		return survey.ID
+	}
+	switch {
+	case survey.Deadline.Before(filter.Now):
+		return 2
+	case survey.Status == 2:
+		return 0
+	case survey.Status == 1:
+		return 1
+	}
+	return 2
 }
 
-// SortSurvey 排序问卷
-func SortSurvey(originalSurveys []model.Survey) []model.Survey {
-	sort.Slice(originalSurveys, func(i, j int) bool {
-		return originalSurveys[i].ID > originalSurveys[j].ID
-	})
-
-	status1Surveys := make([]model.Survey, 0)
-	status2Surveys := make([]model.Survey, 0)
-	status3Surveys := make([]model.Survey, 0)
-	for _, survey := range originalSurveys {
-		if survey.Deadline.Before(time.Now()) {
-			survey.Status = 3
-			status3Surveys = append(status3Surveys, survey)
-			continue
-		}
-
-		if survey.Status == 1 {
-			status1Surveys = append(status1Surveys, survey)
-		} else if survey.Status == 2 {
-			status2Surveys = append(status2Surveys, survey)
-		}
+func encodeSurveyCursor(survey model.Survey, filter dao.SurveyFilter) (string, error) {
+	value, err := json.Marshal(surveySortValue(survey, filter))
+	if err != nil {
+		return "", err
+	}
+	raw, err := json.Marshal(surveyCursor{Sort: filter.Sort, Desc: filter.Desc, Value: value, ID: survey.ID})
+	if err != nil {
+		return "", err
 	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
 
-	sortedSurveys := append(append(status2Surveys, status1Surveys...), status3Surveys...)
-	return sortedSurveys
+func decodeSurveyCursor(cursor string, filter dao.SurveyFilter) (*dao.SurveyCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, code.CursorError
+	}
+	var c surveyCursor
+	if err := json.Unmarshal(raw, &c); err != nil || c.Sort != filter.Sort || c.Desc != filter.Desc {
+		return nil, code.CursorError
+	}
+	var value any
+	switch filter.Sort {
+	case dao.SurveySortCreated, dao.SurveySortDeadline:
+		var t time.Time
+		err = json.Unmarshal(c.Value, &t)
+		value = t
+	case dao.SurveySortTitle:
+		var title string
+		err = json.Unmarshal(c.Value, &title)
+		value = title
+	default:
+		var num int
+		err = json.Unmarshal(c.Value, &num)
+		value = num
+	}
+	if err != nil {
+		return nil, code.CursorError
+	}
+	return &dao.SurveyCursor{Value: value, ID: c.ID}, nil
 }
 
 // GetSurveyResponse 获取问卷响应
@@ -373,15 +477,8 @@ func GetSurveyResponse(surveys []model.Survey) []model.SurveyResp {
 	return response
 }
 
-// GetManagedSurveyByUserID 获取用户管理的问卷
-func GetManagedSurveyByUserID(userId int) ([]model.Manage, error) {
-	var manages []model.Manage
-	manages, err := d.GetManageByUserID(ctx, userId)
-	return manages, err
-}
-
-// GetAllSurveyAnswers 获取所有问卷答案
-func GetAllSurveyAnswers(id int) (dao.AnswersResonse, error) {
+// GetAllSurveyAnswers 获取所有符合条件的问卷答案, 只包含唯一且有效的答卷
+func GetAllSurveyAnswers(id int, filter dao.AnswerFilter) (dao.AnswersResonse, error) {
 	data := make([]dao.QuestionAnswers, 0)
 	answerSheets := make([]dao.AnswerSheet, 0)
 	questions := make([]model.Question, 0)
@@ -390,37 +487,39 @@ func GetAllSurveyAnswers(id int) (dao.AnswersResonse, error) {
 	if err != nil {
 		return dao.AnswersResonse{}, err
 	}
+	questions = AnswerableQuestions(questions)
 	for _, question := range questions {
 		var q dao.QuestionAnswers
 		q.Title = question.Subject
 		q.QuestionType = question.QuestionType
 		data = append(data, q)
 	}
-	answerSheets, _, err = d.GetAnswerSheetBySurveyID(ctx, id, 0, 0, "", true)
+	answerSheets, err = GetSurveyAnswersBySurveyID(id, filter)
 	if err != nil {
 		return dao.AnswersResonse{}, err
 	}
 	for _, answerSheet := range answerSheets {
 		times = append(times, answerSheet.Time)
-		for _, answer := range answerSheet.Answers {
-			question, err := d.GetQuestionByID(ctx, answer.QuestionID)
-			if err != nil {
-				return dao.AnswersResonse{}, err
-			}
-			for i, q := range data {
-				if q.Title == question.Subject {
-					data[i].Answers = append(data[i].Answers, answer.Content)
-				}
-			}
-		}
+		fillAnswers(data, questions, answerSheet)
 	}
 	return dao.AnswersResonse{QuestionAnswers: data, Time: times}, nil
 }
 
-// GetSurveyAnswersBySurveyID 根据问卷编号获取问卷答案
-func GetSurveyAnswersBySurveyID(sid int) ([]dao.AnswerSheet, error) {
-	answerSheets, _, err := d.GetAnswerSheetBySurveyID(ctx, sid, 0, 0, "", true)
-	return answerSheets, err
+// fillAnswers 将一份答卷按问题顺序追加到 data 中, 答卷中没有的问题(如未抽到的题库题目)留空
+func fillAnswers(data []dao.QuestionAnswers, questions []model.Question, answerSheet dao.AnswerSheet) {
+	contents := make(map[int]string, len(answerSheet.Answers))
+	for _, answer := range answerSheet.Answers {
+		contents[answer.QuestionID] = answer.Content
+	}
+	for i, question := range questions {
+		data[i].Answers = append(data[i].Answers, contents[question.ID])
+	}
+}
+
+// GetSurveyAnswersBySurveyID 根据问卷编号获取符合条件的问卷答案, 只包含唯一且有效的答卷
+func GetSurveyAnswersBySurveyID(sid int, filter dao.AnswerFilter) ([]dao.AnswerSheet, error) {
+	filter.Unique = true
+	return d.GetAnswerSheetBySurveyID(ctx, sid, filter, dao.AnswerPage{})
 }
 
 func contains(arr []string, str string) bool {
@@ -448,6 +547,20 @@ func getOldImgs(questions []model.Question) ([]string, error) {
 	return imgs, nil
 }
 
+func getSectionImgs(sid int) ([]string, error) {
+	sections, err := d.GetSectionsBySurveyID(ctx, sid)
+	if err != nil {
+		return nil, err
+	}
+	imgs := make([]string, 0)
+	for _, section := range sections {
+		if section.Img != "" {
+			imgs = append(imgs, section.Img)
+		}
+	}
+	return imgs, nil
+}
+
 func getDelImgs(questions []model.Question, answerSheets []dao.AnswerSheet) ([]string, error) {
 	imgs := make([]string, 0)
 	for _, question := range questions {
@@ -491,12 +604,32 @@ func getDelFiles(answerSheets []dao.AnswerSheet) ([]string, error) {
 	return files, nil
 }
 
-func createQuestionsAndOptions(question_list []dao.QuestionList, sid int) ([]string, error) {
+func createQuestionsAndOptions(sections []dao.SectionList, question_list []dao.QuestionList, sid int) (
+	[]string, error) {
 	imgs := make([]string, 0)
+	// 创建分页, 记录分页序号对应的分页ID
+	sectionIDs := make(map[int]int, len(sections))
+	for _, section := range sections {
+		s, err := d.CreateSection(ctx, model.Section{
+			SurveyID:    sid,
+			SerialNum:   section.SerialNum,
+			Title:       section.Title,
+			Description: section.Description,
+			Img:         section.Img,
+		})
+		if err != nil {
+			return nil, err
+		}
+		sectionIDs[section.SerialNum] = s.ID
+		if section.Img != "" {
+			imgs = append(imgs, section.Img)
+		}
+	}
 	for _, question_list := range question_list {
 		var q model.Question
 		q.SerialNum = question_list.SerialNum
 		q.SurveyID = sid
+		q.SectionID = sectionIDs[question_list.SectionNum]
 		q.Subject = question_list.Subject
 		q.Description = question_list.Description
 		q.Img = question_list.Img
@@ -507,6 +640,11 @@ func createQuestionsAndOptions(question_list []dao.QuestionList, sid int) ([]str
 		q.MaximumOption = question_list.QuestionSetting.MaximumOption
 		q.MinimumOption = question_list.QuestionSetting.MinimumOption
 		q.Reg = question_list.QuestionSetting.Reg
+		q.Shuffle = question_list.QuestionSetting.Shuffle
+		q.InBank = question_list.QuestionSetting.InBank
+		q.CorrectAnswer = question_list.QuestionSetting.CorrectAnswer
+		q.Points = question_list.QuestionSetting.Points
+		q.Explanation = question_list.QuestionSetting.Explanation
 		imgs = append(imgs, question_list.Img)
 		q, err := d.CreateQuestion(ctx, q)
 		if err != nil {
@@ -519,6 +657,7 @@ func createQuestionsAndOptions(question_list []dao.QuestionList, sid int) ([]str
 			o.SerialNum = option.SerialNum
 			o.Img = option.Img
 			o.Description = option.Description
+			o.Pinned = option.Pinned
 			imgs = append(imgs, option.Img)
 			err := d.CreateOption(ctx, o)
 			if err != nil {
@@ -532,6 +671,14 @@ func createQuestionsAndOptions(question_list []dao.QuestionList, sid int) ([]str
 // DeleteAnswerSheetBySurveyID 根据问卷编号删除问卷答案
 func DeleteAnswerSheetBySurveyID(surveyID int) error {
 	err := d.DeleteAnswerSheetBySurveyID(ctx, surveyID)
+	if err != nil {
+		return err
+	}
+	err = d.DeleteUniqueAnswersBySurveyID(ctx, surveyID)
+	if err != nil {
+		return err
+	}
+	err = ResetVoteCounts(surveyID)
 	return err
 }
 
@@ -544,7 +691,7 @@ func aesEncryptPassword(user *model.User) {
 }
 
 // HandleDownloadFile 处理下载文件
-func HandleDownloadFile(answers dao.AnswersResonse, survey *model.Survey) (string, error) {
+func HandleDownloadFile(answers dao.AnswersResonse, survey *model.Survey, groups []GroupStatistics) (string, error) {
 	questionAnswers := answers.QuestionAnswers
 	times := answers.Time
 	// 创建一个新的Excel文件
@@ -616,6 +763,12 @@ func HandleDownloadFile(answers dao.AnswersResonse, survey *model.Survey) (strin
 	if err := streamWriter.Flush(); err != nil {
 		return "", errors.New("关闭失败原因: " + err.Error())
 	}
+	// 写入分组统计
+	if len(groups) > 0 {
+		if err := writeGroupStatistics(f, groups, styleID); err != nil {
+			return "", err
+		}
+	}
 	// 保存Excel文件
 	fileName := survey.Title + ".xlsx"
 	filePath := "./public/xlsx/" + fileName
@@ -642,6 +795,40 @@ func HandleDownloadFile(answers dao.AnswersResonse, survey *model.Survey) (strin
 	return url, nil
 }
 
+// writeGroupStatistics 将分组统计写入新的工作表
+func writeGroupStatistics(f *excelize.File, groups []GroupStatistics, styleID int) error {
+	const sheet = "分组统计"
+	if _, err := f.NewSheet(sheet); err != nil {
+		return errors.New("创建工作表失败原因: " + err.Error())
+	}
+	header := []any{
+		excelize.Cell{Value: "分组", StyleID: styleID},
+		excelize.Cell{Value: "答卷数量", StyleID: styleID},
+		excelize.Cell{Value: "问题", StyleID: styleID},
+		excelize.Cell{Value: "选项", StyleID: styleID},
+		excelize.Cell{Value: "数量", StyleID: styleID},
+	}
+	if err := f.SetSheetRow(sheet, "A1", &header); err != nil {
+		return errors.New("写入标题行失败原因: " + err.Error())
+	}
+	if err := f.SetColWidth(sheet, "A", "E", 20); err != nil {
+		return errors.New("设置列宽失败原因: " + err.Error())
+	}
+	row := 2
+	for _, group := range groups {
+		for _, question := range group.Statistics {
+			for _, option := range question.Options {
+				values := []any{group.Group, group.Total, question.Question, option.Content, option.Count}
+				if err := f.SetSheetRow(sheet, "A"+strconv.Itoa(row), &values); err != nil {
+					return errors.New("写入数据失败原因: " + err.Error())
+				}
+				row++
+			}
+		}
+	}
+	return nil
+}
+
 // UpdateAdminPassword 更新管理员密码
 func UpdateAdminPassword(id int, password string) error {
 	encryptedPassword := utils.AesEncrypt(password)
@@ -676,12 +863,33 @@ func DeleteOauthRecord(sid int) error {
 
 // DeleteAnswerSheetByAnswerID 根据问卷ID删除问卷
 func DeleteAnswerSheetByAnswerID(answerID primitive.ObjectID) error {
-	err := d.DeleteAnswerSheetByAnswerID(ctx, answerID)
-	return err
+	answerSheet, err := d.GetAnswerSheetByAnswerID(ctx, answerID)
+	if err != nil {
+		return err
+	}
+	survey, err := d.GetSurveyByID(ctx, answerSheet.SurveyID)
+	if err != nil {
+		return err
+	}
+	done := beginVoteCountWrite(survey)
+	defer done()
+	err = d.DeleteAnswerSheetByAnswerID(ctx, answerID)
+	if err != nil {
+		return err
+	}
+	err = d.DeleteUniqueAnswersByAnswerID(ctx, answerID, make([]primitive.ObjectID, 0))
+	if err != nil {
+		return err
+	}
+	// 从实时计数中扣除被删除的答卷
+	if isCounted(*answerSheet) {
+		updateVoteCounts(survey, *answerSheet, -1)
+	}
+	return nil
 }
 
-// GetAnswerSheetByAnswerID 根据答卷ID删除答卷
-func GetAnswerSheetByAnswerID(answerID primitive.ObjectID) error {
-	err := d.GetAnswerSheetByAnswerID(ctx, answerID)
-	return err
+// GetAnswerSheetByAnswerID 根据答卷ID获取答卷
+func GetAnswerSheetByAnswerID(answerID primitive.ObjectID) (*dao.AnswerSheet, error) {
+	answerSheet, err := d.GetAnswerSheetByAnswerID(ctx, answerID)
+	return answerSheet, err
 }
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+
+	global "QA-System/internal/global/config"
+	"QA-System/internal/model"
+	"go.uber.org/zap"
+)
+
+// minAnonymousKeyLen 匿名问卷 HMAC 密钥的最短字节数, 密钥过短时可通过穷举学号还原填写者身份
+const minAnonymousKeyLen = 32
+
+// errAnonymousKey 未配置匿名问卷学号 HMAC 密钥或密钥过短
+var errAnonymousKey = errors.New("匿名问卷 HMAC 密钥未配置或长度不足 32 字节, 无法使用匿名问卷")
+
+// anonymousKey 读取并校验匿名问卷学号 HMAC 密钥
+func anonymousKey() ([]byte, error) {
+	key := global.Config.GetString("anonymous.key")
+	if len(key) < minAnonymousKeyLen {
+		return nil, errAnonymousKey
+	}
+	return []byte(key), nil
+}
+
+// CheckAnonymousKey 判断是否配置了可用的匿名问卷学号 HMAC 密钥, 未配置时不允许设置匿名问卷
+func CheckAnonymousKey() error {
+	_, err := anonymousKey()
+	return err
+}
+
+// RespondentID 获取问卷中用于识别统一验证填写者的标识
+// 匿名问卷返回学号按问卷计算的 HMAC, 服务端不保存原始学号, 其余问卷直接返回学号
+func RespondentID(survey *model.Survey, stuId string) (string, error) {
+	if !survey.Anonymous || stuId == "" {
+		return stuId, nil
+	}
+	key, err := anonymousKey()
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte(strconv.Itoa(survey.ID) + ":" + stuId)) //nolint:errcheck
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// ClearAnonymousStudentIDs 清除匿名问卷答卷中记录的学号 HMAC, 匿名问卷曾在允许修改答卷时记录
+func ClearAnonymousStudentIDs() error {
+	ids, err := d.GetAnonymousSurveyIDs(ctx)
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+	modified, err := d.UnsetAnswerSheetStudentIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+	if modified > 0 {
+		zap.L().Info("Cleared student IDs from anonymous answer sheets", zap.Int64("modified", modified))
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	global "QA-System/internal/global/config"
+	"QA-System/internal/model"
+)
+
+func TestRespondentIDRequiresKeyOnlyForAnonymousSurveys(t *testing.T) {
+	configured := global.Config.GetString("anonymous.key")
+	t.Cleanup(func() { global.Config.Set("anonymous.key", configured) })
+
+	survey := &model.Survey{ID: 1}
+	anonymous := &model.Survey{ID: 1, Anonymous: true}
+	global.Config.Set("anonymous.key", "")
+	if id, err := RespondentID(survey, "202300000001"); err != nil || id != "202300000001" {
+		t.Errorf("RespondentID() = %q, %v, want the student ID without a key", id, err)
+	}
+	if _, err := RespondentID(anonymous, "202300000001"); !errors.Is(err, errAnonymousKey) {
+		t.Errorf("RespondentID() error = %v, want %v", err, errAnonymousKey)
+	}
+	if err := CheckAnonymousKey(); !errors.Is(err, errAnonymousKey) {
+		t.Errorf("CheckAnonymousKey() = %v, want %v", err, errAnonymousKey)
+	}
+
+	global.Config.Set("anonymous.key", configured)
+	id, err := RespondentID(anonymous, "202300000001")
+	if err != nil || id == "" || id == "202300000001" {
+		t.Errorf("RespondentID() = %q, %v, want an HMAC of the student ID", id, err)
+	}
+}
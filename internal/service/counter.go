@@ -0,0 +1,392 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"QA-System/internal/dao"
+	"QA-System/internal/model"
+	"QA-System/internal/pkg/redis"
+	redisPkg "github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	voteCountBuilt = "built" // 计数哈希中标记计数已建立的字段
+	voteCountTotal = "total" // 计数哈希中记录答卷总数的字段
+)
+
+const (
+	voteCountRebuildRetries  = 3                // 重建期间有答卷变更时的重试次数
+	voteCountLockExpiration  = 30 * time.Second // 重建锁和临时计数的过期时间
+	voteCountWriteExpiration = time.Minute      // 答卷变更标记的过期时间, 防止进程中断后一直阻止重建
+	voteCountStaleExpiration = 5 * time.Minute  // 清除前的旧计数的保存时长
+)
+
+// voteCountGroup 合并同一实例中对同一问卷计数的并发重建
+var voteCountGroup singleflight.Group
+
+// VoteCounts 投票问卷的实时计数
+type VoteCounts struct {
+	Total   int                 `json:"total"`   // 计入统计的答卷数
+	Options map[int]map[int]int `json:"options"` // 问题ID对应的选项序号对应的票数
+}
+
+// incrVoteCountScript 计数已建立时增减各选项的计数, 未建立时不做修改, 等待读取时从答卷重建
+// ARGV 依次为字段名和增量
+var incrVoteCountScript = redisPkg.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+for i = 1, #ARGV, 2 do
+	redis.call('HINCRBY', KEYS[1], ARGV[i], ARGV[i + 1])
+end
+return 1
+`)
+
+// beginVoteCountWriteScript 递增计数版本并登记一次进行中的答卷变更
+// KEYS 为版本键和变更集合, ARGV 依次为变更的过期时间戳、变更标识和变更集合的过期秒数
+var beginVoteCountWriteScript = redisPkg.NewScript(`
+redis.call('INCR', KEYS[1])
+redis.call('ZADD', KEYS[2], ARGV[1], ARGV[2])
+redis.call('EXPIRE', KEYS[2], ARGV[3])
+return 0
+`)
+
+// endVoteCountWriteScript 递增计数版本并移除已完成的答卷变更
+var endVoteCountWriteScript = redisPkg.NewScript(`
+redis.call('INCR', KEYS[1])
+redis.call('ZREM', KEYS[2], ARGV[1])
+return 0
+`)
+
+// installVoteCountScript 统计期间版本未变且没有进行中的答卷变更时, 用临时计数替换正式计数
+// KEYS 依次为正式计数、临时计数、版本键、变更集合和旧计数, ARGV 依次为统计前的版本和当前时间戳
+var installVoteCountScript = redisPkg.NewScript(`
+local version = redis.call('GET', KEYS[3]) or ''
+redis.call('ZREMRANGEBYSCORE', KEYS[4], '-inf', ARGV[2])
+if version ~= ARGV[1] or redis.call('ZCARD', KEYS[4]) > 0 then
+	redis.call('DEL', KEYS[2])
+	return 0
+end
+redis.call('RENAME', KEYS[2], KEYS[1])
+redis.call('PERSIST', KEYS[1])
+redis.call('DEL', KEYS[5])
+return 1
+`)
+
+// resetVoteCountScript 递增计数版本使进行中的重建失效, 并将正式计数保留为旧计数
+// KEYS 依次为正式计数、旧计数和版本键, ARGV 为旧计数的保存秒数
+var resetVoteCountScript = redisPkg.NewScript(`
+redis.call('INCR', KEYS[3])
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	redis.call('RENAME', KEYS[1], KEYS[2])
+	redis.call('EXPIRE', KEYS[2], ARGV[1])
+end
+return 0
+`)
+
+// unlockVoteCountScript 只释放自己持有的重建锁
+var unlockVoteCountScript = redisPkg.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+func voteCountKey(sid int) string {
+	return fmt.Sprintf("survey:%d:vote_counts", sid)
+}
+
+// voteCountVersionKey 计数版本, 答卷变更和清除计数时递增
+func voteCountVersionKey(sid int) string {
+	return fmt.Sprintf("survey:%d:vote_counts_version", sid)
+}
+
+// voteCountWritingKey 进行中的答卷变更, 分数为变更的过期时间戳
+func voteCountWritingKey(sid int) string {
+	return fmt.Sprintf("survey:%d:vote_counts_writing", sid)
+}
+
+func voteCountLockKey(sid int) string {
+	return fmt.Sprintf("survey:%d:vote_counts_lock", sid)
+}
+
+func voteCountStaleKey(sid int) string {
+	return fmt.Sprintf("survey:%d:vote_counts_stale", sid)
+}
+
+// voteCountField 选项计数字段, 格式为 问题ID:选项序号, "其他" 选项序号为 0
+func voteCountField(qid int, serialNum int) string {
+	return strconv.Itoa(qid) + ":" + strconv.Itoa(serialNum)
+}
+
+// countVotes 统计答卷中各选项的票数
+func countVotes(answerSheet dao.AnswerSheet, counts map[string]int64) error {
+	for _, answer := range answerSheet.Answers {
+		question, err := d.GetQuestionByID(ctx, answer.QuestionID)
+		if err != nil {
+			return err
+		}
+		if question.QuestionType != 1 {
+			continue
+		}
+		options, err := d.GetOptionsByQuestionID(ctx, question.ID)
+		if err != nil {
+			return err
+		}
+		serialNums := make(map[string]int, len(options))
+		for _, option := range options {
+			serialNums[option.Content] = option.SerialNum
+		}
+		for _, content := range strings.Split(answer.Content, "┋") {
+			// 不存在的选项计入 "其他" 选项
+			counts[voteCountField(question.ID, serialNums[content])]++
+		}
+	}
+	return nil
+}
+
+// isCounted 判断答卷是否计入统计
+func isCounted(answerSheet dao.AnswerSheet) bool {
+	return answerSheet.Unique && !answerSheet.Invalid
+}
+
+// UpdateVoteCounts 按答卷增减投票问卷的实时计数, delta 为 1 或 -1
+func UpdateVoteCounts(survey *model.Survey, answerSheet dao.AnswerSheet, delta int64) error {
+	if survey.Type != 1 {
+		return nil
+	}
+	counts := make(map[string]int64)
+	if err := countVotes(answerSheet, counts); err != nil {
+		return err
+	}
+	counts[voteCountTotal] = 1
+	args := make([]any, 0, 2*len(counts))
+	for field, count := range counts {
+		args = append(args, field, count*delta)
+	}
+	return incrVoteCountScript.Run(ctx, redis.RedisClient, []string{voteCountKey(survey.ID)}, args...).Err()
+}
+
+// updateVoteCounts 更新实时计数并推送给实时结果的订阅者, 失败时只记录日志, 计数偏差可通过重建修复
+func updateVoteCounts(survey *model.Survey, answerSheet dao.AnswerSheet, delta int64) {
+	if survey.Type != 1 {
+		return
+	}
+	if err := UpdateVoteCounts(survey, answerSheet, delta); err != nil {
+		zap.L().Error("Failed to update vote counts", zap.Int("survey_id", survey.ID), zap.Error(err))
+		return
+	}
+	if err := PublishLiveResults(survey.ID); err != nil {
+		zap.L().Error("Failed to publish live results", zap.Int("survey_id", survey.ID), zap.Error(err))
+	}
+}
+
+// GetVoteCounts 获取投票问卷各问题各选项的实时计数, 计数未建立时从答卷重建
+func GetVoteCounts(sid int) (VoteCounts, error) {
+	fields, err := redis.RedisClient.HGetAll(ctx, voteCountKey(sid)).Result()
+	if err != nil {
+		return VoteCounts{}, err
+	}
+	if len(fields) > 0 {
+		return parseVoteCounts(fields), nil
+	}
+	// 同一实例中的并发请求共用一次重建
+	counts, err, _ := voteCountGroup.Do(strconv.Itoa(sid), func() (any, error) {
+		return loadVoteCounts(sid)
+	})
+	if err != nil {
+		return VoteCounts{}, err
+	}
+	return counts.(VoteCounts), nil
+}
+
+// loadVoteCounts 计数未建立时只由获得锁的请求重建, 其余请求读取清除前的旧计数, 没有旧计数时返回空计数
+func loadVoteCounts(sid int) (VoteCounts, error) {
+	token := primitive.NewObjectID().Hex()
+	locked, err := redis.RedisClient.SetNX(ctx, voteCountLockKey(sid), token, voteCountLockExpiration).Result()
+	if err != nil {
+		return VoteCounts{}, err
+	}
+	if !locked {
+		fields, err := redis.RedisClient.HGetAll(ctx, voteCountStaleKey(sid)).Result()
+		if err != nil {
+			return VoteCounts{}, err
+		}
+		return parseVoteCounts(fields), nil
+	}
+	defer func() {
+		err := unlockVoteCountScript.Run(ctx, redis.RedisClient, []string{voteCountLockKey(sid)}, token).Err()
+		if err != nil {
+			zap.L().Error("Failed to release vote counts lock", zap.Int("survey_id", sid), zap.Error(err))
+		}
+	}()
+	return RebuildVoteCounts(sid)
+}
+
+// parseVoteCounts 解析计数哈希
+func parseVoteCounts(fields map[string]string) VoteCounts {
+	result := VoteCounts{Options: make(map[int]map[int]int)}
+	result.Total, _ = strconv.Atoi(fields[voteCountTotal])
+	for field, value := range fields {
+		qid, serialNum, ok := strings.Cut(field, ":")
+		if !ok {
+			continue
+		}
+		questionID, err := strconv.Atoi(qid)
+		if err != nil {
+			continue
+		}
+		num, err := strconv.Atoi(serialNum)
+		if err != nil {
+			continue
+		}
+		count, err := strconv.Atoi(value)
+		if err != nil {
+			continue
+		}
+		ensureMap(result.Options, questionID)[num] = count
+	}
+	return result
+}
+
+// RebuildVoteCounts 从答卷重新统计投票问卷的实时计数, 用于修复计数偏差
+// 重建期间有答卷变更时放弃写入并重试, 多次重试仍有变更时只返回本次统计的结果
+func RebuildVoteCounts(sid int) (VoteCounts, error) {
+	var result VoteCounts
+	for i := 0; i < voteCountRebuildRetries; i++ {
+		counts, installed, err := rebuildVoteCounts(sid)
+		if err != nil || installed {
+			return counts, err
+		}
+		result = counts
+	}
+	return result, nil
+}
+
+// rebuildVoteCounts 将答卷统计结果写入临时键, 统计期间没有答卷变更时再替换为正式计数
+func rebuildVoteCounts(sid int) (VoteCounts, bool, error) {
+	version, err := redis.RedisClient.Get(ctx, voteCountVersionKey(sid)).Result()
+	if err != nil && !errors.Is(err, redisPkg.Nil) {
+		return VoteCounts{}, false, err
+	}
+	answerSheets, err := GetSurveyAnswersBySurveyID(sid, dao.AnswerFilter{})
+	if err != nil {
+		return VoteCounts{}, false, err
+	}
+	counts := make(map[string]int64)
+	result := VoteCounts{Total: len(answerSheets), Options: make(map[int]map[int]int)}
+	for _, answerSheet := range answerSheets {
+		if err := countVotes(answerSheet, counts); err != nil {
+			return VoteCounts{}, false, err
+		}
+	}
+	values := make([]any, 0, 2*len(counts)+4)
+	values = append(values, voteCountBuilt, 1, voteCountTotal, len(answerSheets))
+	for field, count := range counts {
+		values = append(values, field, count)
+		qid, serialNum, _ := strings.Cut(field, ":")
+		questionID, _ := strconv.Atoi(qid)
+		num, _ := strconv.Atoi(serialNum)
+		ensureMap(result.Options, questionID)[num] = int(count)
+	}
+	temp := voteCountKey(sid) + ":rebuild:" + primitive.NewObjectID().Hex()
+	_, err = redis.RedisClient.TxPipelined(ctx, func(pipe redisPkg.Pipeliner) error {
+		pipe.HSet(ctx, temp, values...)
+		pipe.Expire(ctx, temp, voteCountLockExpiration)
+		return nil
+	})
+	if err != nil {
+		return VoteCounts{}, false, err
+	}
+	keys := []string{voteCountKey(sid), temp, voteCountVersionKey(sid), voteCountWritingKey(sid), voteCountStaleKey(sid)}
+	installed, err := installVoteCountScript.Run(ctx, redis.RedisClient, keys, version, time.Now().Unix()).Bool()
+	return result, installed, err
+}
+
+// beginVoteCountWrite 在修改计入实时计数的答卷前调用, 同时进行的重建会放弃写入可能遗漏这次修改的结果
+// 返回的函数需在实时计数更新后调用
+func beginVoteCountWrite(survey *model.Survey) func() {
+	if survey.Type != 1 {
+		return func() {}
+	}
+	token := primitive.NewObjectID().Hex()
+	keys := []string{voteCountVersionKey(survey.ID), voteCountWritingKey(survey.ID)}
+	expireAt := time.Now().Add(voteCountWriteExpiration).Unix()
+	err := beginVoteCountWriteScript.Run(ctx, redis.RedisClient, keys,
+		expireAt, token, int64(voteCountWriteExpiration.Seconds())).Err()
+	if err != nil {
+		zap.L().Error("Failed to begin vote counts write", zap.Int("survey_id", survey.ID), zap.Error(err))
+	}
+	return func() {
+		if err := endVoteCountWriteScript.Run(ctx, redis.RedisClient, keys, token).Err(); err != nil {
+			zap.L().Error("Failed to end vote counts write", zap.Int("survey_id", survey.ID), zap.Error(err))
+		}
+	}
+}
+
+func liveResultsChannel(sid int) string {
+	return fmt.Sprintf("survey:%d:live", sid)
+}
+
+// PublishLiveResults 通过 Redis 发布问卷的最新计数, 各服务实例的订阅者都会收到
+func PublishLiveResults(sid int) error {
+	counts, err := GetVoteCounts(sid)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(counts)
+	if err != nil {
+		return err
+	}
+	return redis.RedisClient.Publish(ctx, liveResultsChannel(sid), payload).Err()
+}
+
+// SubscribeLiveResults 订阅问卷的实时计数, 使用完毕后需关闭订阅
+func SubscribeLiveResults(c context.Context, sid int) *redisPkg.PubSub {
+	return redis.RedisClient.Subscribe(c, liveResultsChannel(sid))
+}
+
+// ResetVoteCounts 清除实时计数, 下次读取时从答卷重建, 重建完成前其他请求读取清除前的旧计数
+func ResetVoteCounts(sid int) error {
+	keys := []string{voteCountKey(sid), voteCountStaleKey(sid), voteCountVersionKey(sid)}
+	return resetVoteCountScript.Run(ctx, redis.RedisClient, keys, int64(voteCountStaleExpiration.Seconds())).Err()
+}
+
+// displaceAnswerSheet 保留最新答卷时将被取代的答卷标记为不唯一, 并从实时计数中扣除
+func displaceAnswerSheet(answerID primitive.ObjectID) error {
+	answerSheet, err := d.GetAnswerSheetByAnswerID(ctx, answerID)
+	if err != nil {
+		return err
+	}
+	if !answerSheet.Unique {
+		return nil
+	}
+	if err := d.SetAnswerSheetUnique(ctx, answerID, false); err != nil {
+		return err
+	}
+	if answerSheet.Invalid {
+		return nil
+	}
+	survey, err := d.GetSurveyByID(ctx, answerSheet.SurveyID)
+	if err != nil {
+		return err
+	}
+	updateVoteCounts(survey, *answerSheet, -1)
+	return nil
+}
+
+func ensureMap(m map[int]map[int]int, key int) map[int]int {
+	if m[key] == nil {
+		m[key] = make(map[int]int)
+	}
+	return m[key]
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"QA-System/internal/model"
+	"QA-System/internal/pkg/redis"
+)
+
+// installTempCounts 写入一份临时计数并尝试替换正式计数
+func installTempCounts(t *testing.T, sid int, version string) bool {
+	t.Helper()
+	temp := voteCountKey(sid) + ":rebuild:test"
+	if err := redis.RedisClient.HSet(ctx, temp, voteCountBuilt, 1, voteCountTotal, 7).Err(); err != nil {
+		t.Fatalf("HSet() error = %v", err)
+	}
+	keys := []string{voteCountKey(sid), temp, voteCountVersionKey(sid), voteCountWritingKey(sid), voteCountStaleKey(sid)}
+	installed, err := installVoteCountScript.Run(ctx, redis.RedisClient, keys, version, time.Now().Unix()).Bool()
+	if err != nil {
+		t.Fatalf("installVoteCountScript error = %v", err)
+	}
+	return installed
+}
+
+func currentVersion(t *testing.T, sid int) string {
+	t.Helper()
+	version, _ := redis.RedisClient.Get(ctx, voteCountVersionKey(sid)).Result()
+	return version
+}
+
+func TestInstallVoteCountsSkipsConcurrentWrites(t *testing.T) {
+	useMiniredis(t)
+	survey := &model.Survey{ID: 1, Type: 1}
+
+	// 重建期间有进行中的答卷变更
+	version := currentVersion(t, survey.ID)
+	done := beginVoteCountWrite(survey)
+	if installTempCounts(t, survey.ID, version) {
+		t.Fatal("installed counts while a write is in progress")
+	}
+	// 答卷变更在重建期间完成
+	done()
+	if installTempCounts(t, survey.ID, version) {
+		t.Fatal("installed counts after a write finished during the rebuild")
+	}
+	// 重建期间计数被清除
+	version = currentVersion(t, survey.ID)
+	if err := ResetVoteCounts(survey.ID); err != nil {
+		t.Fatalf("ResetVoteCounts() error = %v", err)
+	}
+	if installTempCounts(t, survey.ID, version) {
+		t.Fatal("installed counts after a reset during the rebuild")
+	}
+	// 重建期间没有变更
+	if !installTempCounts(t, survey.ID, currentVersion(t, survey.ID)) {
+		t.Fatal("counts not installed without concurrent writes")
+	}
+	counts, err := GetVoteCounts(survey.ID)
+	if err != nil {
+		t.Fatalf("GetVoteCounts() error = %v", err)
+	}
+	if counts.Total != 7 {
+		t.Errorf("GetVoteCounts().Total = %d, want 7", counts.Total)
+	}
+}
+
+func TestGetVoteCountsServesStaleWhileRebuilding(t *testing.T) {
+	useMiniredis(t)
+	sid := 1
+	err := redis.RedisClient.HSet(ctx, voteCountKey(sid), voteCountBuilt, 1, voteCountTotal, 3, "5:1", 2).Err()
+	if err != nil {
+		t.Fatalf("HSet() error = %v", err)
+	}
+	if err = ResetVoteCounts(sid); err != nil {
+		t.Fatalf("ResetVoteCounts() error = %v", err)
+	}
+	// 其他请求正在重建
+	if err := redis.RedisClient.Set(ctx, voteCountLockKey(sid), "other", voteCountLockExpiration).Err(); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	counts, err := GetVoteCounts(sid)
+	if err != nil {
+		t.Fatalf("GetVoteCounts() error = %v", err)
+	}
+	if counts.Total != 3 || counts.Options[5][1] != 2 {
+		t.Errorf("GetVoteCounts() = %+v, want stale counts", counts)
+	}
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"QA-System/internal/dao"
+	"QA-System/internal/model"
+	"QA-System/internal/pkg/redis"
+	redisPkg "github.com/redis/go-redis/v9"
+)
+
+// draftExpiration 草稿最长保存时长
+const draftExpiration = 7 * 24 * time.Hour
+
+// Draft 问卷草稿
+type Draft struct {
+	QuestionsList []dao.QuestionsList `json:"questions_list"` // 已填写的答案
+	Time          time.Time           `json:"time"`           // 保存时间
+}
+
+func draftKey(sid int, respondentKey string) string {
+	return fmt.Sprintf("survey:%d:draft:%s", sid, respondentKey)
+}
+
+// SaveDraft 保存问卷草稿, 草稿在问卷截止或保存七天后过期
+func SaveDraft(survey *model.Survey, respondentKey string, questionsList []dao.QuestionsList) error {
+	expiration := draftExpiration
+	if !survey.Deadline.IsZero() && time.Until(survey.Deadline) < expiration {
+		expiration = time.Until(survey.Deadline)
+	}
+	if expiration <= 0 {
+		return nil
+	}
+	jsonData, err := json.Marshal(Draft{QuestionsList: questionsList, Time: time.Now()})
+	if err != nil {
+		return err
+	}
+	return redis.RedisClient.Set(ctx, draftKey(survey.ID, respondentKey), jsonData, expiration).Err()
+}
+
+// GetDraft 获取问卷草稿, 没有草稿时返回 nil
+func GetDraft(sid int, respondentKey string) (*Draft, error) {
+	cachedData, err := redis.RedisClient.Get(ctx, draftKey(sid, respondentKey)).Result()
+	if errors.Is(err, redisPkg.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var draft Draft
+	if err := json.Unmarshal([]byte(cachedData), &draft); err != nil {
+		return nil, err
+	}
+	return &draft, nil
+}
+
+// DeleteDraft 删除问卷草稿
+func DeleteDraft(sid int, respondentKey string) error {
+	return redis.RedisClient.Del(ctx, draftKey(sid, respondentKey)).Err()
+}
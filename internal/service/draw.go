@@ -0,0 +1,114 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"QA-System/internal/model"
+	"QA-System/internal/pkg/code"
+	"QA-System/internal/pkg/redis"
+	redisPkg "github.com/redis/go-redis/v9"
+)
+
+// defaultDrawExpiration 问卷没有截止时间时抽题结果的保存时长
+const defaultDrawExpiration = 30 * 24 * time.Hour
+
+func drawKey(sid int, respondentKey string) string {
+	return fmt.Sprintf("survey:%d:draw:%s", sid, respondentKey)
+}
+
+// DrawQuestions 为填写者从题库中抽取题目, 返回该填写者需要作答的题目
+// 同一填写者重复获取问卷时返回相同的抽题结果
+func DrawQuestions(survey *model.Survey, questions []model.Question, respondentKey string) ([]model.Question, error) {
+	if survey.DrawNum == 0 {
+		return questions, nil
+	}
+	drawn, err := getDrawnIDs(survey.ID, respondentKey)
+	if err == nil {
+		return filterDrawnQuestions(questions, drawn), nil
+	}
+	if !errors.Is(err, redisPkg.Nil) {
+		return nil, err
+	}
+
+	bank := make([]int, 0)
+	for _, question := range questions {
+		if question.InBank {
+			bank = append(bank, question.ID)
+		}
+	}
+	rand.Shuffle(len(bank), func(i, j int) { //nolint:gosec // 抽题无需密码学安全的随机数
+		bank[i], bank[j] = bank[j], bank[i]
+	})
+	if uint(len(bank)) > survey.DrawNum {
+		bank = bank[:survey.DrawNum]
+	}
+
+	expiration := defaultDrawExpiration
+	if !survey.Deadline.IsZero() && time.Until(survey.Deadline) > 0 {
+		expiration = time.Until(survey.Deadline)
+	}
+	jsonData, err := json.Marshal(bank)
+	if err != nil {
+		return nil, err
+	}
+	// 使用 SetNX 防止并发获取问卷时覆盖已有的抽题结果
+	ok, err := redis.RedisClient.SetNX(ctx, drawKey(survey.ID, respondentKey), jsonData, expiration).Result()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		drawn, err = getDrawnIDs(survey.ID, respondentKey)
+		if err != nil {
+			return nil, err
+		}
+		return filterDrawnQuestions(questions, drawn), nil
+	}
+	return filterDrawnQuestions(questions, bank), nil
+}
+
+// GetDrawnQuestions 获取填写者已抽取的题目, 未抽题时返回 code.DrawNotFound
+func GetDrawnQuestions(survey *model.Survey, questions []model.Question, respondentKey string) (
+	[]model.Question, error) {
+	if survey.DrawNum == 0 {
+		return questions, nil
+	}
+	drawn, err := getDrawnIDs(survey.ID, respondentKey)
+	if errors.Is(err, redisPkg.Nil) {
+		return nil, code.DrawNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return filterDrawnQuestions(questions, drawn), nil
+}
+
+func getDrawnIDs(sid int, respondentKey string) ([]int, error) {
+	cachedData, err := redis.RedisClient.Get(ctx, drawKey(sid, respondentKey)).Result()
+	if err != nil {
+		return nil, err
+	}
+	var drawn []int
+	if err := json.Unmarshal([]byte(cachedData), &drawn); err != nil {
+		return nil, err
+	}
+	return drawn, nil
+}
+
+// filterDrawnQuestions 保留非题库题目和已抽取的题库题目, 保持原有顺序
+func filterDrawnQuestions(questions []model.Question, drawn []int) []model.Question {
+	drawnMap := make(map[int]bool, len(drawn))
+	for _, id := range drawn {
+		drawnMap[id] = true
+	}
+	result := make([]model.Question, 0, len(questions))
+	for _, question := range questions {
+		if !question.InBank || drawnMap[question.ID] {
+			result = append(result, question)
+		}
+	}
+	return result
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"strings"
+
+	"QA-System/internal/dao"
+	"QA-System/internal/model"
+	"QA-System/internal/pkg/code"
+	"github.com/zjutjh/WeJH-SDK/oauth"
+)
+
+// CheckEligibility 判断统一验证的填写者是否符合问卷的填写资格, 不符合时返回对应的错误
+func CheckEligibility(survey *model.Survey, userInfo oauth.UserInfo) *code.Error {
+	if !matchAny(survey.EligibleUserTypes, userInfo.UserTypeDesc, strings.EqualFold) {
+		return code.UserTypeIneligibleError
+	}
+	if !matchAny(survey.EligibleColleges, userInfo.College, strings.EqualFold) {
+		return code.CollegeIneligibleError
+	}
+	if !matchAny(survey.EligibleGenders, userInfo.Gender, strings.EqualFold) {
+		return code.GenderIneligibleError
+	}
+	if !matchAny(survey.EligibleStuIDPrefixes, userInfo.StudentID, strings.HasPrefix) {
+		return code.StudentIDIneligibleError
+	}
+	return nil
+}
+
+// GetEligibility 获取问卷的填写资格配置
+func GetEligibility(survey *model.Survey) dao.Eligibility {
+	return dao.Eligibility{
+		UserTypes:     splitList(survey.EligibleUserTypes),
+		Colleges:      splitList(survey.EligibleColleges),
+		Genders:       splitList(survey.EligibleGenders),
+		StuIDPrefixes: splitList(survey.EligibleStuIDPrefixes),
+	}
+}
+
+// applyEligibility 将填写资格配置写入问卷模型
+func applyEligibility(survey *model.Survey, eligibility dao.Eligibility) {
+	survey.EligibleUserTypes = joinList(eligibility.UserTypes)
+	survey.EligibleColleges = joinList(eligibility.Colleges)
+	survey.EligibleGenders = joinList(eligibility.Genders)
+	survey.EligibleStuIDPrefixes = joinList(eligibility.StuIDPrefixes)
+}
+
+// matchAny 判断值是否满足以┋分隔的任一规则, 规则为空时不限制
+func matchAny(rules string, value string, match func(string, string) bool) bool {
+	if rules == "" {
+		return true
+	}
+	for _, rule := range strings.Split(rules, "┋") {
+		if match(value, rule) {
+			return true
+		}
+	}
+	return false
+}
+
+func splitList(s string) []string {
+	if s == "" {
+		return make([]string, 0)
+	}
+	return strings.Split(s, "┋")
+}
+
+func joinList(list []string) string {
+	items := make([]string, 0, len(list))
+	for _, item := range list {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return strings.Join(items, "┋")
+}
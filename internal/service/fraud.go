@@ -0,0 +1,210 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"QA-System/internal/dao"
+	"QA-System/internal/model"
+	"QA-System/internal/pkg/redis"
+	redisPkg "github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// openedExpiration 获取问卷时间的保存时长
+const openedExpiration = 24 * time.Hour
+
+// 可疑答卷的标记原因
+const (
+	FraudFast    = "fast"    // 填写用时过短
+	FraudBurst   = "burst"   // 同一网段短时间内集中提交
+	FraudPattern = "pattern" // 同一网段提交了大量相同的答案
+)
+
+// FraudOptions 可疑答卷的判定阈值
+type FraudOptions struct {
+	MinDuration int64 // 填写用时少于该秒数视为过快
+	BurstWindow int64 // 集中提交的时间窗口秒数
+	BurstSize   int   // 同一网段在时间窗口内提交达到该数量视为集中提交
+	PatternSize int   // 同一网段相同答案达到该数量视为重复答案
+}
+
+// FlaggedSheet 可疑答卷
+type FlaggedSheet struct {
+	AnswerID      primitive.ObjectID `json:"answer_id"`
+	Time          string             `json:"time"`
+	IP            string             `json:"ip"`
+	IPRange       string             `json:"ip_range"`
+	UserAgentHash string             `json:"user_agent_hash"`
+	Duration      int64              `json:"duration"`
+	Invalid       bool               `json:"invalid"`
+	Reasons       []string           `json:"reasons"`
+}
+
+// FraudReport 问卷刷票分析报告
+type FraudReport struct {
+	Total   int            `json:"total"`   // 答卷总数
+	Invalid int            `json:"invalid"` // 已标记为无效的答卷数
+	Flagged int            `json:"flagged"` // 可疑答卷数
+	Sheets  []FlaggedSheet `json:"sheets"`  // 可疑答卷
+}
+
+func openedKey(sid int, respondentKey string) string {
+	return fmt.Sprintf("survey:%d:opened:%s", sid, respondentKey)
+}
+
+// RecordSurveyOpened 记录填写者首次获取问卷的时间
+func RecordSurveyOpened(sid int, respondentKey string) error {
+	return redis.RedisClient.SetNX(ctx, openedKey(sid, respondentKey), time.Now().Unix(), openedExpiration).Err()
+}
+
+// NewSubmitMeta 构建答卷提交信息, 匿名问卷只记录IP所在网段
+func NewSubmitMeta(survey *model.Survey, respondentKey string, ip string, userAgent string) (*dao.SubmitMeta, error) {
+	ua := sha256.Sum256([]byte(userAgent))
+	meta := &dao.SubmitMeta{
+		IPRange:       ipRange(ip),
+		UserAgentHash: hex.EncodeToString(ua[:8]),
+	}
+	if !survey.Anonymous {
+		meta.IP = ip
+	}
+	opened, err := redis.RedisClient.Get(ctx, openedKey(survey.ID, respondentKey)).Int64()
+	if errors.Is(err, redisPkg.Nil) {
+		return meta, nil
+	} else if err != nil {
+		return nil, err
+	}
+	// 用时至少记为 1 秒, 0 只表示未知
+	meta.Duration = max(time.Now().Unix()-opened, 1)
+	return meta, nil
+}
+
+// ipRange 获取IP所在网段, IPv4 取 /24, IPv6 取 /48
+func ipRange(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ip
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return (&net.IPNet{IP: v4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}).String()
+	}
+	return (&net.IPNet{IP: parsed.Mask(net.CIDRMask(48, 128)), Mask: net.CIDRMask(48, 128)}).String()
+}
+
+// GetFraudReport 分析问卷答卷, 标记填写过快、集中提交和重复答案的可疑答卷
+func GetFraudReport(sid int, opts FraudOptions) (FraudReport, error) {
+	answerSheets, err := d.GetAnswerSheetBySurveyID(ctx, sid, dao.AnswerFilter{}, dao.AnswerPage{})
+	if err != nil {
+		return FraudReport{}, err
+	}
+	reasons := make([][]string, len(answerSheets))
+	ranges := make(map[string][]int)
+	patterns := make(map[string][]int)
+	report := FraudReport{Total: len(answerSheets), Sheets: make([]FlaggedSheet, 0)}
+	for i, answerSheet := range answerSheets {
+		if answerSheet.Invalid {
+			report.Invalid++
+		}
+		// 没有提交信息的答卷无法分析
+		if answerSheet.Meta == nil {
+			continue
+		}
+		// 用时未知的答卷不作判断, 清除缓存或更换客户端令牌的正常填写者同样没有获取问卷的记录
+		if answerSheet.Meta.Duration > 0 && answerSheet.Meta.Duration < opts.MinDuration {
+			reasons[i] = append(reasons[i], FraudFast)
+		}
+		ranges[answerSheet.Meta.IPRange] = append(ranges[answerSheet.Meta.IPRange], i)
+		pattern := answerSheet.Meta.IPRange + "|" + answerPattern(answerSheet)
+		patterns[pattern] = append(patterns[pattern], i)
+	}
+	for _, indexes := range ranges {
+		for _, i := range burstSheets(answerSheets, indexes, opts) {
+			reasons[i] = append(reasons[i], FraudBurst)
+		}
+	}
+	for _, indexes := range patterns {
+		if len(indexes) < opts.PatternSize {
+			continue
+		}
+		for _, i := range indexes {
+			reasons[i] = append(reasons[i], FraudPattern)
+		}
+	}
+	for i, answerSheet := range answerSheets {
+		if len(reasons[i]) == 0 {
+			continue
+		}
+		report.Sheets = append(report.Sheets, FlaggedSheet{
+			AnswerID:      answerSheet.AnswerID,
+			Time:          answerSheet.Time,
+			IP:            answerSheet.Meta.IP,
+			IPRange:       answerSheet.Meta.IPRange,
+			UserAgentHash: answerSheet.Meta.UserAgentHash,
+			Duration:      answerSheet.Meta.Duration,
+			Invalid:       answerSheet.Invalid,
+			Reasons:       reasons[i],
+		})
+	}
+	report.Flagged = len(report.Sheets)
+	return report, nil
+}
+
+// answerPattern 将答卷答案按问题ID顺序拼接, 用于比较答案是否相同
+func answerPattern(answerSheet dao.AnswerSheet) string {
+	answers := make([]dao.Answer, len(answerSheet.Answers))
+	copy(answers, answerSheet.Answers)
+	sort.Slice(answers, func(i, j int) bool { return answers[i].QuestionID < answers[j].QuestionID })
+	parts := make([]string, 0, len(answers))
+	for _, answer := range answers {
+		parts = append(parts, fmt.Sprintf("%d:%s", answer.QuestionID, answer.Content))
+	}
+	return strings.Join(parts, "\n")
+}
+
+// burstSheets 返回同一网段中落在集中提交时间窗口内的答卷下标
+func burstSheets(answerSheets []dao.AnswerSheet, indexes []int, opts FraudOptions) []int {
+	if opts.BurstSize <= 1 || len(indexes) < opts.BurstSize {
+		return nil
+	}
+	// 按答卷创建时间排序
+	sort.Slice(indexes, func(i, j int) bool {
+		return answerSheets[indexes[i]].AnswerID.Timestamp().Before(answerSheets[indexes[j]].AnswerID.Timestamp())
+	})
+	window := time.Duration(opts.BurstWindow) * time.Second
+	flagged := make(map[int]bool)
+	start := 0
+	for end := range indexes {
+		endTime := answerSheets[indexes[end]].AnswerID.Timestamp()
+		for endTime.Sub(answerSheets[indexes[start]].AnswerID.Timestamp()) > window {
+			start++
+		}
+		if end-start+1 >= opts.BurstSize {
+			for _, i := range indexes[start : end+1] {
+				flagged[i] = true
+			}
+		}
+	}
+	result := make([]int, 0, len(flagged))
+	for _, i := range indexes {
+		if flagged[i] {
+			result = append(result, i)
+		}
+	}
+	return result
+}
+
+// MarkAnswerSheetsInvalid 标记或取消标记答卷为无效, 返回修改的答卷数
+func MarkAnswerSheetsInvalid(sid int, answerIDs []primitive.ObjectID, invalid bool) (int64, error) {
+	modified, err := d.SetAnswerSheetsInvalid(ctx, sid, answerIDs, invalid)
+	if err != nil || modified == 0 {
+		return modified, err
+	}
+	// 答卷有效性变化后重建实时计数
+	return modified, ResetVoteCounts(sid)
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"errors"
+	"io"
+	"strings"
+
+	"QA-System/internal/model"
+	"QA-System/internal/pkg/code"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ImportInvitations 从 xlsx 或 csv 文件批量生成邀请, 返回新生成的邀请
+// 文件第一列为姓名, 第二列为邮箱(可选), 表头行和空行会被跳过
+func ImportInvitations(sid int, reader io.Reader, filename string) ([]model.Invitation, error) {
+	rows, err := readSpreadsheetRows(reader, filename)
+	if err != nil {
+		return nil, err
+	}
+	invitations := make([]model.Invitation, 0, len(rows))
+	for _, row := range rows {
+		if len(row) == 0 {
+			continue
+		}
+		name := strings.TrimSpace(row[0])
+		if name == "" || name == "姓名" {
+			continue
+		}
+		invitation := model.Invitation{
+			SurveyID: sid,
+			Token:    strings.ReplaceAll(uuid.NewString(), "-", ""),
+			Name:     name,
+			Status:   1,
+		}
+		if len(row) > 1 {
+			invitation.Email = strings.TrimSpace(row[1])
+		}
+		invitations = append(invitations, invitation)
+	}
+	return invitations, d.CreateInvitations(ctx, invitations)
+}
+
+// GetInvitations 获取问卷的邀请, status 为 0 时获取全部
+func GetInvitations(sid int, status int) ([]model.Invitation, error) {
+	return d.GetInvitationsBySurveyID(ctx, sid, status)
+}
+
+// GetInvitationByID 根据邀请ID获取邀请
+func GetInvitationByID(id int) (*model.Invitation, error) {
+	return d.GetInvitationByID(ctx, id)
+}
+
+// RevokeInvitation 撤销未使用的邀请, 邀请已被使用时返回 code.InvitationUsedError
+func RevokeInvitation(id int) error {
+	ok, err := d.RevokeInvitation(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return code.InvitationUsedError
+	}
+	return nil
+}
+
+// CheckInvitation 判断邀请令牌是否可以使用, 不可使用时返回对应的错误
+func CheckInvitation(survey *model.Survey, token string) error {
+	if token == "" {
+		return code.InvitationInvalidError
+	}
+	invitation, err := d.GetInvitationByToken(ctx, survey.ID, token)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return code.InvitationInvalidError
+	} else if err != nil {
+		return err
+	}
+	switch invitation.Status {
+	case 1:
+		return nil
+	case 2:
+		return code.InvitationUsedError
+	default:
+		return code.InvitationInvalidError
+	}
+}
+
+// UseInvitation 提交前占用邀请, 保证每个邀请只能提交一次
+func UseInvitation(survey *model.Survey, token string) error {
+	if err := CheckInvitation(survey, token); err != nil {
+		return err
+	}
+	ok, err := d.UseInvitation(ctx, survey.ID, token)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return code.InvitationUsedError
+	}
+	return nil
+}
+
+// ReleaseInvitation 提交失败时归还邀请
+func ReleaseInvitation(survey *model.Survey, token string) error {
+	return d.ReleaseInvitation(ctx, survey.ID, token)
+}
+
+// BindInvitationAnswer 记录邀请对应的答卷
+func BindInvitationAnswer(survey *model.Survey, token string, answerID string) error {
+	return d.UpdateInvitationAnswerID(ctx, survey.ID, token, answerID)
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/bits"
+	"strings"
+	"time"
+
+	"QA-System/internal/model"
+	"QA-System/internal/pkg/code"
+	"QA-System/internal/pkg/redis"
+	"github.com/google/uuid"
+	redisPkg "github.com/redis/go-redis/v9"
+)
+
+const (
+	// powDifficulty 工作量证明要求的哈希前导零位数
+	powDifficulty = 18
+	// powExpiration 工作量证明挑战的有效期
+	powExpiration = 10 * time.Minute
+)
+
+// Challenge 工作量证明挑战
+// 填写者需找到 nonce, 使 sha256(token + nonce) 的前 difficulty 位均为 0
+type Challenge struct {
+	Token      string `json:"token"`
+	Difficulty int    `json:"difficulty"`
+}
+
+func challengeKey(sid int, token string) string {
+	return fmt.Sprintf("survey:%d:pow:%s", sid, token)
+}
+
+// NewChallenge 为问卷生成工作量证明挑战
+func NewChallenge(sid int) (Challenge, error) {
+	token := strings.ReplaceAll(uuid.NewString(), "-", "")
+	err := redis.RedisClient.Set(ctx, challengeKey(sid, token), powDifficulty, powExpiration).Err()
+	if err != nil {
+		return Challenge{}, err
+	}
+	return Challenge{Token: token, Difficulty: powDifficulty}, nil
+}
+
+// VerifyChallenge 校验工作量证明, 每个挑战只能使用一次, 校验失败时返回 code.ChallengeError
+func VerifyChallenge(sid int, token string, nonce string) error {
+	if token == "" {
+		return code.ChallengeError
+	}
+	difficulty, err := redis.RedisClient.GetDel(ctx, challengeKey(sid, token)).Int()
+	if errors.Is(err, redisPkg.Nil) {
+		return code.ChallengeError
+	} else if err != nil {
+		return err
+	}
+	if leadingZeroBits(sha256.Sum256([]byte(token+nonce))) < difficulty {
+		return code.ChallengeError
+	}
+	return nil
+}
+
+func leadingZeroBits(sum [sha256.Size]byte) int {
+	n := 0
+	for _, b := range sum {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+		n += 8
+	}
+	return n
+}
+
+// NewDeviceID 生成设备标识, 保存在填写者的 cookie 中
+func NewDeviceID() string {
+	return uuid.NewString()
+}
+
+func submitCountKey(sid int, kind string, id string) string {
+	return fmt.Sprintf("survey:%d:submit_count:%s:%s", sid, kind, id)
+}
+
+// submitRateLimits 获取问卷设置的IP和设备提交次数限制, 返回计数键、上限和过期时间戳, 次数在第二天零点清零
+func submitRateLimits(survey *model.Survey, ip string, deviceID string) ([]string, []any) {
+	now := time.Now()
+	tomorrow := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).Add(24 * time.Hour)
+	keys := make([]string, 0, 2)
+	args := make([]any, 0, 4)
+	if survey.IPLimit > 0 {
+		keys = append(keys, submitCountKey(survey.ID, "ip", ip))
+		args = append(args, survey.IPLimit, tomorrow.Unix())
+	}
+	if survey.DeviceLimit > 0 {
+		keys = append(keys, submitCountKey(survey.ID, "device", deviceID))
+		args = append(args, survey.DeviceLimit, tomorrow.Unix())
+	}
+	return keys, args
+}
+
+// ReserveSubmitRate 原子地检查并占用一次IP和设备的当日提交次数, IP或设备次数已达上限时
+// 分别返回 code.IPLimitError 和 code.DeviceLimitError
+func ReserveSubmitRate(survey *model.Survey, ip string, deviceID string) error {
+	if survey.DeviceLimit > 0 && deviceID == "" {
+		return code.DeviceLimitError
+	}
+	keys, args := submitRateLimits(survey, ip, deviceID)
+	if len(keys) == 0 {
+		return nil
+	}
+	exceeded, err := reserveLimitScript.Run(ctx, redis.RedisClient, keys, args...).Int()
+	if err != nil {
+		return err
+	}
+	if exceeded == 0 {
+		return nil
+	}
+	if survey.IPLimit > 0 && exceeded == 1 {
+		return code.IPLimitError
+	}
+	return code.DeviceLimitError
+}
+
+// ReleaseSubmitRate 提交失败时归还已占用的提交次数
+func ReleaseSubmitRate(survey *model.Survey, ip string, deviceID string) error {
+	keys, _ := submitRateLimits(survey, ip, deviceID)
+	if len(keys) == 0 {
+		return nil
+	}
+	return releaseLimitScript.Run(ctx, redis.RedisClient, keys).Err()
+}
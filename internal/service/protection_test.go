@@ -0,0 +1,50 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"QA-System/internal/model"
+	"QA-System/internal/pkg/code"
+)
+
+func TestReserveSubmitRateConcurrent(t *testing.T) {
+	useMiniredis(t)
+	survey := &model.Survey{ID: 1, IPLimit: 2, DeviceLimit: 5}
+	const workers = 30
+	var succeeded atomic.Int32
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			err := ReserveSubmitRate(survey, "10.0.0.1", "device")
+			if err == nil {
+				succeeded.Add(1)
+			} else if !errors.Is(err, code.IPLimitError) {
+				t.Errorf("ReserveSubmitRate() unexpected error: %v", err)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+	if got := succeeded.Load(); got != 2 {
+		t.Fatalf("succeeded reservations = %d, want 2", got)
+	}
+
+	// 归还后可再次占用
+	if err := ReleaseSubmitRate(survey, "10.0.0.1", "device"); err != nil {
+		t.Fatalf("ReleaseSubmitRate() error = %v", err)
+	}
+	if err := ReserveSubmitRate(survey, "10.0.0.1", "device"); err != nil {
+		t.Fatalf("ReserveSubmitRate() after release error = %v", err)
+	}
+	// 开启设备限制时必须携带设备标识
+	if err := ReserveSubmitRate(survey, "10.0.0.2", ""); !errors.Is(err, code.DeviceLimitError) {
+		t.Fatalf("ReserveSubmitRate() without device error = %v, want %v", err, code.DeviceLimitError)
+	}
+}
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"sort"
+	"strings"
+
+	"QA-System/internal/dao"
+	"QA-System/internal/model"
+)
+
+// QuizQuestionResult 测验单题批改结果
+type QuizQuestionResult struct {
+	QuestionID    int    `json:"question_id"`
+	SerialNum     int    `json:"serial_num"`
+	Correct       bool   `json:"correct"`
+	Points        uint   `json:"points"`
+	CorrectAnswer string `json:"correct_answer"`
+	Explanation   string `json:"explanation"`
+}
+
+// QuizResult 测验批改结果
+type QuizResult struct {
+	Score      uint                 `json:"score"`
+	TotalScore uint                 `json:"total_score"`
+	Questions  []QuizQuestionResult `json:"questions"`
+}
+
+// ScoreCount 测验分数分布
+type ScoreCount struct {
+	Score uint `json:"score"`
+	Count int  `json:"count"`
+}
+
+// QuestionCorrectRate 测验题目正确率
+type QuestionCorrectRate struct {
+	SerialNum int     `json:"serial_num"`
+	Question  string  `json:"question"`
+	Answered  int     `json:"answered"`
+	Correct   int     `json:"correct"`
+	Rate      float64 `json:"rate"`
+}
+
+// QuizStatistics 测验统计
+type QuizStatistics struct {
+	Total        int                   `json:"total"`
+	Average      float64               `json:"average"`
+	Max          uint                  `json:"max"`
+	Min          uint                  `json:"min"`
+	Distribution []ScoreCount          `json:"distribution"`
+	Questions    []QuestionCorrectRate `json:"questions"`
+}
+
+// isGradable 判断题目是否需要批改
+func isGradable(question *model.Question) bool {
+	if question.CorrectAnswer == "" {
+		return false
+	}
+	return question.QuestionType == 1 || question.QuestionType == 2 || question.QuestionType == 3
+}
+
+// isCorrect 判断答案是否正确
+func isCorrect(question *model.Question, content string) bool {
+	correctAnswers := strings.Split(question.CorrectAnswer, "┋")
+	switch question.QuestionType {
+	case 2:
+		// 多选题需选中且仅选中全部正确选项, 按去重后的选项集合比较
+		return sameOptions(strings.Split(content, "┋"), correctAnswers)
+	case 3:
+		// 填空题匹配任一可接受的答案, 忽略首尾空白和大小写
+		for _, correctAnswer := range correctAnswers {
+			if strings.EqualFold(strings.TrimSpace(content), strings.TrimSpace(correctAnswer)) {
+				return true
+			}
+		}
+		return false
+	default:
+		return content == question.CorrectAnswer
+	}
+}
+
+// sameOptions 判断两组选项去重后是否相同
+func sameOptions(answers []string, correctAnswers []string) bool {
+	selected := make(map[string]bool, len(answers))
+	for _, answer := range answers {
+		selected[answer] = true
+	}
+	expected := make(map[string]bool, len(correctAnswers))
+	for _, correctAnswer := range correctAnswers {
+		if !selected[correctAnswer] {
+			return false
+		}
+		expected[correctAnswer] = true
+	}
+	return len(selected) == len(expected)
+}
+
+// gradeAnswerSheet 批改测验答卷, 记录每题是否正确并计算得分
+func gradeAnswerSheet(answerSheet *dao.AnswerSheet, questions map[int]*model.Question) {
+	answerSheet.Score = 0
+	for i, answer := range answerSheet.Answers {
+		question := questions[answer.QuestionID]
+		if question == nil || !isGradable(question) {
+			continue
+		}
+		correct := isCorrect(question, answer.Content)
+		answerSheet.Answers[i].Correct = &correct
+		if correct {
+			answerSheet.Score += question.Points
+		}
+	}
+}
+
+// GetQuizResult 获取测验答卷的批改结果
+func GetQuizResult(answerSheet dao.AnswerSheet) (QuizResult, error) {
+	result := QuizResult{
+		Score:     answerSheet.Score,
+		Questions: make([]QuizQuestionResult, 0),
+	}
+	for _, answer := range answerSheet.Answers {
+		if answer.Correct == nil {
+			continue
+		}
+		question, err := d.GetQuestionByID(ctx, answer.QuestionID)
+		if err != nil {
+			return QuizResult{}, err
+		}
+		result.TotalScore += question.Points
+		result.Questions = append(result.Questions, QuizQuestionResult{
+			QuestionID:    question.ID,
+			SerialNum:     question.SerialNum,
+			Correct:       *answer.Correct,
+			Points:        question.Points,
+			CorrectAnswer: question.CorrectAnswer,
+			Explanation:   question.Explanation,
+		})
+	}
+	return result, nil
+}
+
+// GetQuizStatistics 获取测验的分数分布和各题正确率
+func GetQuizStatistics(answerSheets []dao.AnswerSheet, questions []model.Question) QuizStatistics {
+	statistics := QuizStatistics{
+		Total:        len(answerSheets),
+		Distribution: make([]ScoreCount, 0),
+		Questions:    make([]QuestionCorrectRate, 0),
+	}
+	rates := make(map[int]*QuestionCorrectRate)
+	for _, question := range questions {
+		if !isGradable(&question) {
+			continue
+		}
+		rates[question.ID] = &QuestionCorrectRate{
+			SerialNum: question.SerialNum,
+			Question:  question.Subject,
+		}
+	}
+
+	scoreCounts := make(map[uint]int)
+	var sum uint
+	for i, sheet := range answerSheets {
+		scoreCounts[sheet.Score]++
+		sum += sheet.Score
+		if i == 0 || sheet.Score > statistics.Max {
+			statistics.Max = sheet.Score
+		}
+		if i == 0 || sheet.Score < statistics.Min {
+			statistics.Min = sheet.Score
+		}
+		for _, answer := range sheet.Answers {
+			rate, ok := rates[answer.QuestionID]
+			if !ok || answer.Correct == nil {
+				continue
+			}
+			rate.Answered++
+			if *answer.Correct {
+				rate.Correct++
+			}
+		}
+	}
+	if len(answerSheets) > 0 {
+		statistics.Average = float64(sum) / float64(len(answerSheets))
+	}
+
+	for score, count := range scoreCounts {
+		statistics.Distribution = append(statistics.Distribution, ScoreCount{Score: score, Count: count})
+	}
+	sort.Slice(statistics.Distribution, func(i, j int) bool {
+		return statistics.Distribution[i].Score < statistics.Distribution[j].Score
+	})
+
+	for _, question := range questions {
+		rate, ok := rates[question.ID]
+		if !ok {
+			continue
+		}
+		if rate.Answered > 0 {
+			rate.Rate = float64(rate.Correct) / float64(rate.Answered)
+		}
+		statistics.Questions = append(statistics.Questions, *rate)
+	}
+	return statistics
+}
@@ -0,0 +1,27 @@
+package service
+
+import (
+	"testing"
+
+	"QA-System/internal/model"
+)
+
+func TestIsCorrectMultipleChoice(t *testing.T) {
+	question := &model.Question{QuestionType: 2, CorrectAnswer: "A┋B"}
+	tests := []struct {
+		content string
+		want    bool
+	}{
+		{"A┋B", true},
+		{"B┋A", true},
+		{"A┋A", false},
+		{"A", false},
+		{"A┋B┋C", false},
+		{"A┋B┋B", true},
+	}
+	for _, tt := range tests {
+		if got := isCorrect(question, tt.content); got != tt.want {
+			t.Errorf("isCorrect(%q) = %v, want %v", tt.content, got, tt.want)
+		}
+	}
+}
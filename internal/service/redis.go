@@ -1,80 +1,99 @@
 package service
 
 import (
-	"context"
-	"errors"
-	"fmt"
 	"strconv"
 	"time"
 
 	"QA-System/internal/model"
-	"QA-System/internal/pkg/redis" // 保留你自己项目中的 Redis 包
-	"github.com/gin-gonic/gin"
+	"QA-System/internal/pkg/code"
+	"QA-System/internal/pkg/redis"          // 保留你自己项目中的 Redis 包
 	redisPkg "github.com/redis/go-redis/v9" // 添加 Redis 库
 )
 
-// GetUserLimit 获取用户的对该问卷的访问次数
-func GetUserLimit(c context.Context, stu_id string, sid int, durationType string) (int, error) {
-	// 从 redis 中获取用户的对该问卷的访问次数, durationtype为dailyLimit或sumLimit
-	item := "survey:" + strconv.Itoa(sid) + ":duration_type:" + durationType + ":stu_id:" + stu_id
-	var limit int
-	err := redis.RedisClient.Get(c, item).Scan(&limit)
-	return limit, err
-}
+// reserveLimitScript 原子地检查并增加各项计数, 用于投票次数和提交频率限制
+// KEYS 为各项计数键, ARGV 依次为每个键的上限和过期时间戳(0为不过期)
+// 任一计数已达上限时不做修改并返回该键的序号, 否则全部加一并返回 0
+var reserveLimitScript = redisPkg.NewScript(`
+for i, key in ipairs(KEYS) do
+	local count = tonumber(redis.call('GET', key) or '0')
+	if count >= tonumber(ARGV[2 * i - 1]) then
+		return i
+	end
+end
+for i, key in ipairs(KEYS) do
+	if redis.call('INCR', key) == 1 then
+		local expireAt = tonumber(ARGV[2 * i])
+		if expireAt > 0 then
+			redis.call('EXPIREAT', key, expireAt)
+		end
+	end
+end
+return 0
+`)
+
+// releaseLimitScript 归还已占用的次数, 计数不会减到 0 以下
+var releaseLimitScript = redisPkg.NewScript(`
+for _, key in ipairs(KEYS) do
+	if tonumber(redis.call('GET', key) or '0') > 0 then
+		redis.call('DECR', key)
+	end
+end
+return 0
+`)
 
-// SetUserLimit 设置用户的对该问卷的单日访问次数
-func SetUserLimit(c context.Context, stuId string, sid int, limit int, durationType string) error {
-	// 设置用户的对该问卷的访问次数, durationtype为dailyLimit或sumLimit
-	item := "survey:" + strconv.Itoa(sid) + ":duration_type:" + durationType + ":stu_id:" + stuId
-	// 获取当前时间和第二天零点的时间
-	now := time.Now()
-	tomorrow := time.Date(
-		now.Year(),
-		now.Month(),
-		now.Day(),
-		0, 0, 0, 0,
-		now.Location(),
-	).Add(24 * time.Hour)
-	duration := time.Until(tomorrow) // 计算当前时间到第二天零点的时间间隔
-	err := redis.RedisClient.Set(c, item, limit, duration).Err()
-	return err
+// voteLimitKey 获取填写者投票次数的计数键, durationType为dailyLimit或sumLimit
+func voteLimitKey(stuId string, sid int, durationType string) string {
+	return "survey:" + strconv.Itoa(sid) + ":duration_type:" + durationType + ":stu_id:" + stuId
 }
 
-// InscUserLimit 更新用户的对该问卷的访问次数+1
-func InscUserLimit(c context.Context, stuId string, sid int, durationType string) error {
-	// 更新用户的对该问卷的访问次数,durationtype为dailyLimit或sumLimit
-	item := "survey:" + strconv.Itoa(sid) + ":duration_type:" + durationType + ":stu_id:" + stuId
-	err := redis.RedisClient.Incr(c, item).Err()
-	return err
+// voteLimits 获取问卷设置的投票限制, 返回计数键、上限和过期时间戳
+func voteLimits(stuId string, survey *model.Survey) ([]string, []any) {
+	keys := make([]string, 0, 2)
+	args := make([]any, 0, 4)
+	// 总投票次数在问卷截止时过期, 未设置截止时间时不过期
+	if survey.SumLimit > 0 {
+		var expireAt int64
+		if !survey.Deadline.IsZero() {
+			expireAt = survey.Deadline.Unix()
+		}
+		keys = append(keys, voteLimitKey(stuId, survey.ID, "sumLimit"))
+		args = append(args, survey.SumLimit, expireAt)
+	}
+	// 单日投票次数在第二天零点过期
+	if survey.DailyLimit > 0 {
+		now := time.Now()
+		tomorrow := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).Add(24 * time.Hour)
+		keys = append(keys, voteLimitKey(stuId, survey.ID, "dailyLimit"))
+		args = append(args, survey.DailyLimit, tomorrow.Unix())
+	}
+	return keys, args
 }
 
-// SetUserSumLimit 设置用户对该问卷的总访问次数
-func SetUserSumLimit(c context.Context, stuId string, sid int, sumLimit int, durationType string) error {
-	// 设置用户的对该问卷的访问次数, durationtype为dailyLimit或sumLimit
-	item := "survey:" + strconv.Itoa(sid) + ":duration_type:" + durationType + ":stu_id:" + stuId
-	// 获取当前时间到问卷截止的时间
-	var survey *model.Survey
-	survey, err := GetSurveyByID(sid)
+// ReserveVoteLimit 原子地检查并占用一次投票次数, 总投票次数或单日投票次数已达上限时
+// 分别返回 code.VoteSumLimitError 和 code.VoteLimitError
+func ReserveVoteLimit(stuId string, survey *model.Survey) error {
+	keys, args := voteLimits(stuId, survey)
+	if len(keys) == 0 {
+		return nil
+	}
+	exceeded, err := reserveLimitScript.Run(ctx, redis.RedisClient, keys, args...).Int()
 	if err != nil {
 		return err
 	}
-	endTime := survey.Deadline
-	sumDuration := time.Until(endTime)
-	err = redis.RedisClient.Set(c, item, sumLimit, sumDuration).Err()
-	return err
-}
-
-// CheckLimit 判断限制次数
-func CheckLimit(c *gin.Context, stuId string, survey *model.Survey, key string, limitVal int) (bool, error) {
-	if limitVal == 0 {
-		return false, nil
+	if exceeded == 0 {
+		return nil
 	}
-	limit, err := GetUserLimit(c, stuId, survey.ID, key)
-	if err != nil && !errors.Is(err, redisPkg.Nil) {
-		return false, err
+	if keys[exceeded-1] == voteLimitKey(stuId, survey.ID, "sumLimit") {
+		return code.VoteSumLimitError
 	}
-	if err == nil && limit >= limitVal {
-		return false, fmt.Errorf("%s已达上限", key)
+	return code.VoteLimitError
+}
+
+// ReleaseVoteLimit 提交失败时归还已占用的投票次数
+func ReleaseVoteLimit(stuId string, survey *model.Survey) error {
+	keys, _ := voteLimits(stuId, survey)
+	if len(keys) == 0 {
+		return nil
 	}
-	return errors.Is(err, redisPkg.Nil), nil
+	return releaseLimitScript.Run(ctx, redis.RedisClient, keys).Err()
 }
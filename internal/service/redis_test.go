@@ -0,0 +1,122 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"QA-System/internal/model"
+	"QA-System/internal/pkg/code"
+	"QA-System/internal/pkg/redis"
+	"github.com/alicebob/miniredis/v2"
+	redisPkg "github.com/redis/go-redis/v9"
+)
+
+// useMiniredis 将 Redis 客户端替换为连接内存 Redis 的客户端, 测试结束后恢复
+func useMiniredis(t *testing.T) *miniredis.Miniredis {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redisPkg.NewClient(&redisPkg.Options{Addr: server.Addr()})
+	previous := redis.RedisClient
+	redis.RedisClient = client
+	t.Cleanup(func() {
+		redis.RedisClient = previous
+		_ = client.Close()
+	})
+	return server
+}
+
+func TestReserveVoteLimitConcurrent(t *testing.T) {
+	tests := []struct {
+		name   string
+		survey *model.Survey
+		limit  int
+		want   error
+	}{
+		{
+			name:   "sum limit",
+			survey: &model.Survey{ID: 1, SumLimit: 3, Deadline: time.Now().Add(time.Hour)},
+			limit:  3,
+			want:   code.VoteSumLimitError,
+		},
+		{
+			name:   "daily limit",
+			survey: &model.Survey{ID: 2, DailyLimit: 2},
+			limit:  2,
+			want:   code.VoteLimitError,
+		},
+		{
+			name:   "daily limit within sum limit",
+			survey: &model.Survey{ID: 3, SumLimit: 5, DailyLimit: 1, Deadline: time.Now().Add(time.Hour)},
+			limit:  1,
+			want:   code.VoteLimitError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useMiniredis(t)
+			const workers = 50
+			var succeeded, rejected atomic.Int32
+			var wg sync.WaitGroup
+			start := make(chan struct{})
+			for i := 0; i < workers; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					<-start
+					err := ReserveVoteLimit("202312345678", tt.survey)
+					switch {
+					case err == nil:
+						succeeded.Add(1)
+					case errors.Is(err, tt.want):
+						rejected.Add(1)
+					default:
+						t.Errorf("ReserveVoteLimit() unexpected error: %v", err)
+					}
+				}()
+			}
+			close(start)
+			wg.Wait()
+			if got := int(succeeded.Load()); got != tt.limit {
+				t.Errorf("succeeded reservations = %d, want %d", got, tt.limit)
+			}
+			if got := int(rejected.Load()); got != workers-tt.limit {
+				t.Errorf("rejected reservations = %d, want %d", got, workers-tt.limit)
+			}
+		})
+	}
+}
+
+func TestReleaseVoteLimit(t *testing.T) {
+	useMiniredis(t)
+	survey := &model.Survey{ID: 1, SumLimit: 1, DailyLimit: 1, Deadline: time.Now().Add(time.Hour)}
+	stuId := "202312345678"
+
+	if err := ReserveVoteLimit(stuId, survey); err != nil {
+		t.Fatalf("first ReserveVoteLimit() error = %v", err)
+	}
+	if err := ReserveVoteLimit(stuId, survey); !errors.Is(err, code.VoteSumLimitError) {
+		t.Fatalf("ReserveVoteLimit() over limit error = %v, want %v", err, code.VoteSumLimitError)
+	}
+	if err := ReleaseVoteLimit(stuId, survey); err != nil {
+		t.Fatalf("ReleaseVoteLimit() error = %v", err)
+	}
+	if err := ReserveVoteLimit(stuId, survey); err != nil {
+		t.Fatalf("ReserveVoteLimit() after release error = %v", err)
+	}
+
+	// 多次归还不会让计数低于 0, 也就不会多出投票次数
+	for i := 0; i < 3; i++ {
+		if err := ReleaseVoteLimit(stuId, survey); err != nil {
+			t.Fatalf("ReleaseVoteLimit() error = %v", err)
+		}
+	}
+	if err := ReserveVoteLimit(stuId, survey); err != nil {
+		t.Fatalf("ReserveVoteLimit() after repeated release error = %v", err)
+	}
+	if err := ReserveVoteLimit(stuId, survey); !errors.Is(err, code.VoteSumLimitError) {
+		t.Fatalf("ReserveVoteLimit() over limit error = %v, want %v", err, code.VoteSumLimitError)
+	}
+}
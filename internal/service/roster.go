@@ -0,0 +1,255 @@
+package service
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"QA-System/internal/model"
+	"QA-System/internal/pkg/code"
+	"github.com/xuri/excelize/v2"
+)
+
+// RosterEntry 名单人员填写情况
+type RosterEntry struct {
+	StudentID string `json:"student_id"` // 学号
+	Name      string `json:"name"`       // 姓名
+	College   string `json:"college"`    // 学院, 未填写时为空
+	Time      string `json:"time"`       // 最近提交时间, 未填写时为空
+	Count     int    `json:"count"`      // 提交次数
+}
+
+// RosterReport 名单填写情况
+type RosterReport struct {
+	Total        int           `json:"total"`         // 应填写人数
+	Denied       int           `json:"denied"`        // 禁止名单人数
+	Responded    []RosterEntry `json:"responded"`     // 已填写
+	NotResponded []RosterEntry `json:"not_responded"` // 未填写
+}
+
+// ImportRoster 从 xlsx 或 csv 文件导入问卷名单, 覆盖原有同类型名单, 返回导入人数
+// 文件第一列为学号, 第二列为姓名(可选), 权重名单第三列为正整数权重, 表头行和空行会被跳过
+func ImportRoster(sid int, listType int, reader io.Reader, filename string) (int, error) {
+	rows, err := readSpreadsheetRows(reader, filename)
+	if err != nil {
+		return 0, err
+	}
+	rosters := make([]model.Roster, 0, len(rows))
+	seen := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		if len(row) == 0 {
+			continue
+		}
+		stuId := strings.TrimSpace(row[0])
+		if stuId == "" || stuId == "学号" || seen[stuId] {
+			continue
+		}
+		seen[stuId] = true
+		roster := model.Roster{SurveyID: sid, ListType: listType, StudentID: stuId}
+		if len(row) > 1 {
+			roster.Name = strings.TrimSpace(row[1])
+		}
+		if listType == 4 {
+			if len(row) < 3 {
+				return 0, errors.Join(code.RosterFileError, errors.New("学号"+stuId+"缺少权重"))
+			}
+			weight, err := strconv.ParseUint(strings.TrimSpace(row[2]), 10, 32)
+			if err != nil || weight == 0 {
+				return 0, errors.Join(code.RosterFileError, errors.New("学号"+stuId+"的权重无效"))
+			}
+			roster.Weight = uint(weight)
+		}
+		rosters = append(rosters, roster)
+	}
+	if err := d.ReplaceRosters(ctx, sid, listType, rosters); err != nil {
+		return 0, err
+	}
+	return len(rosters), nil
+}
+
+// readSpreadsheetRows 读取 xlsx 或 csv 文件的全部行
+func readSpreadsheetRows(reader io.Reader, filename string) ([][]string, error) {
+	var rows [][]string
+	var err error
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".xlsx":
+		rows, err = readXlsxRows(reader)
+	case ".csv":
+		rows, err = csv.NewReader(reader).ReadAll()
+	default:
+		return nil, code.RosterFileError
+	}
+	if err != nil {
+		return nil, errors.Join(code.RosterFileError, err)
+	}
+	// 去除 csv 文件开头可能存在的 BOM
+	if len(rows) > 0 && len(rows[0]) > 0 {
+		rows[0][0] = strings.TrimPrefix(rows[0][0], "\ufeff")
+	}
+	return rows, nil
+}
+
+func readXlsxRows(reader io.Reader) ([][]string, error) {
+	f, err := excelize.OpenReader(reader)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close() //nolint:errcheck
+	}()
+	return f.GetRows(f.GetSheetName(0))
+}
+
+// DeleteRoster 删除问卷名单
+func DeleteRoster(sid int, listType int) error {
+	return d.DeleteRosters(ctx, sid, listType)
+}
+
+// CheckRoster 判断填写者是否在问卷名单允许范围内
+// 在禁止名单中时返回 code.RosterDeniedError, 设置了允许名单但不在其中时返回 code.NotInRosterError
+func CheckRoster(sid int, stuId string) error {
+	rosters, err := d.GetRostersByStudentID(ctx, sid, stuId)
+	if err != nil {
+		return err
+	}
+	allowed := false
+	for _, roster := range rosters {
+		if roster.ListType == 2 {
+			return code.RosterDeniedError
+		}
+		allowed = allowed || roster.ListType == 1
+	}
+	if allowed {
+		return nil
+	}
+	count, err := d.CountRosters(ctx, sid, 1)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return code.NotInRosterError
+	}
+	return nil
+}
+
+// GetRosterReport 根据统一验证记录统计允许名单和应填名单中已填写和未填写的人员
+// 匿名问卷只统计是否填写, 不包含学院和提交时间
+func GetRosterReport(survey *model.Survey) (RosterReport, error) {
+	sid := survey.ID
+	rosters, err := d.GetRostersBySurveyID(ctx, sid, 1)
+	if err != nil {
+		return RosterReport{}, err
+	}
+	expected, err := d.GetRostersBySurveyID(ctx, sid, 3)
+	if err != nil {
+		return RosterReport{}, err
+	}
+	rosters = append(rosters, expected...)
+	denied, err := d.CountRosters(ctx, sid, 2)
+	if err != nil {
+		return RosterReport{}, err
+	}
+	records, err := d.GetRecordSheetsBySurveyID(ctx, sid)
+	if err != nil {
+		return RosterReport{}, err
+	}
+	// 按学号汇总提交记录, 保留最近一次提交的信息
+	entries := make(map[string]*RosterEntry, len(records))
+	latest := make(map[string]time.Time, len(records))
+	for _, record := range records {
+		entry, ok := entries[record.StudentID]
+		if !ok {
+			entry = &RosterEntry{StudentID: record.StudentID}
+			entries[record.StudentID] = entry
+		}
+		entry.Count++
+		if record.Time.After(latest[record.StudentID]) {
+			latest[record.StudentID] = record.Time
+			entry.Name = record.Name
+			entry.College = record.College
+			entry.Time = record.Time.Format("2006-01-02 15:04:05")
+		}
+	}
+	report := RosterReport{
+		Denied:       int(denied),
+		Responded:    make([]RosterEntry, 0),
+		NotResponded: make([]RosterEntry, 0),
+	}
+	seen := make(map[string]bool, len(rosters))
+	for _, roster := range rosters {
+		if seen[roster.StudentID] {
+			continue
+		}
+		seen[roster.StudentID] = true
+		respondentID, err := RespondentID(survey, roster.StudentID)
+		if err != nil {
+			return RosterReport{}, err
+		}
+		if entry, ok := entries[respondentID]; ok {
+			responded := *entry
+			responded.StudentID = roster.StudentID
+			if responded.Name == "" {
+				responded.Name = roster.Name
+			}
+			report.Responded = append(report.Responded, responded)
+		} else {
+			report.NotResponded = append(report.NotResponded, RosterEntry{
+				StudentID: roster.StudentID,
+				Name:      roster.Name,
+			})
+		}
+	}
+	report.Total = len(seen)
+	return report, nil
+}
+
+// ExportRosterReport 导出名单填写情况, 未填写人员排在前面, 返回文件链接
+func ExportRosterReport(report RosterReport, survey *model.Survey) (string, error) {
+	f := excelize.NewFile()
+	defer func() {
+		_ = f.Close() //nolint:errcheck
+	}()
+	styleID, err := f.NewStyle(&excelize.Style{
+		Font: &excelize.Font{Bold: true},
+	})
+	if err != nil {
+		return "", errors.New("设置字体样式失败原因: " + err.Error())
+	}
+	header := []any{"学号", "姓名", "学院", "填写状态", "最近提交时间", "提交次数"}
+	if err := f.SetSheetRow("Sheet1", "A1", &header); err != nil {
+		return "", errors.New("写入标题行失败原因: " + err.Error())
+	}
+	if err := f.SetRowStyle("Sheet1", 1, 1, styleID); err != nil {
+		return "", errors.New("设置标题行样式失败原因: " + err.Error())
+	}
+	if err := f.SetColWidth("Sheet1", "A", "F", 20); err != nil {
+		return "", errors.New("设置列宽失败原因: " + err.Error())
+	}
+	row := 2
+	for _, entries := range [][]RosterEntry{report.NotResponded, report.Responded} {
+		for _, entry := range entries {
+			status := "未填写"
+			if entry.Count > 0 {
+				status = "已填写"
+			}
+			values := []any{entry.StudentID, entry.Name, entry.College, status, entry.Time, entry.Count}
+			if err := f.SetSheetRow("Sheet1", "A"+strconv.Itoa(row), &values); err != nil {
+				return "", errors.New("写入数据失败原因: " + err.Error())
+			}
+			row++
+		}
+	}
+	if err := os.MkdirAll("./public/xlsx/", 0750); err != nil {
+		return "", errors.New("创建文件夹失败原因: " + err.Error())
+	}
+	fileName := survey.Title + "-填写情况.xlsx"
+	if err := f.SaveAs("./public/xlsx/" + fileName); err != nil {
+		return "", errors.New("保存文件失败原因: " + err.Error())
+	}
+	return GetConfigUrl() + "/public/xlsx/" + fileName, nil
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"hash/fnv"
+	"math/rand/v2"
+	"strconv"
+
+	"QA-System/internal/model"
+	"github.com/google/uuid"
+)
+
+// NewClientToken 生成新的客户端令牌, 用于标识未统一验证的填写者
+func NewClientToken() string {
+	return uuid.New().String()
+}
+
+// RespondentKey 获取填写者标识, 已统一验证时使用学号, 否则使用客户端令牌
+func RespondentKey(stuId string, clientToken string) string {
+	if stuId != "" {
+		return "stu:" + stuId
+	}
+	return "client:" + clientToken
+}
+
+// ShuffleSeed 根据问卷和填写者标识生成随机种子, 同一填写者多次获取问卷时顺序保持一致
+func ShuffleSeed(sid int, respondentKey string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(strconv.Itoa(sid) + ":" + respondentKey)) //nolint:errcheck
+	return h.Sum64()
+}
+
+// ShuffleQuestions 按种子在各分页内打乱题目顺序, 展示块位置保持不变, 返回新的切片, 不修改原切片
+func ShuffleQuestions(questions []model.Question, seed uint64) []model.Question {
+	shuffled := make([]model.Question, len(questions))
+	copy(shuffled, questions)
+	// 按分页收集可打乱题目所在的位置
+	positions := make(map[int][]int)
+	sectionIDs := make([]int, 0)
+	for i, question := range shuffled {
+		if question.QuestionType == 7 {
+			continue
+		}
+		if _, ok := positions[question.SectionID]; !ok {
+			sectionIDs = append(sectionIDs, question.SectionID)
+		}
+		positions[question.SectionID] = append(positions[question.SectionID], i)
+	}
+	for _, sectionID := range sectionIDs {
+		pos := positions[sectionID]
+		r := rand.New(rand.NewPCG(seed, uint64(sectionID))) //nolint:gosec // 打乱顺序无需密码学安全的随机数
+		r.Shuffle(len(pos), func(i, j int) {
+			shuffled[pos[i]], shuffled[pos[j]] = shuffled[pos[j]], shuffled[pos[i]]
+		})
+	}
+	return shuffled
+}
+
+// ShuffleOptions 按种子打乱问题的选项顺序, 固定的选项位置保持不变, 返回新的切片, 不修改原切片
+// "其他"选项由问题的 OtherOption 设置提供, 不在选项列表中, 不受打乱影响
+func ShuffleOptions(options []model.Option, seed uint64, qid int) []model.Option {
+	shuffled := make([]model.Option, len(options))
+	copy(shuffled, options)
+	pos := make([]int, 0, len(shuffled))
+	for i, option := range shuffled {
+		if !option.Pinned {
+			pos = append(pos, i)
+		}
+	}
+	// 每道题使用不同的随机流, 避免选项数相同的题目打乱结果相同
+	r := rand.New(rand.NewPCG(seed, uint64(qid))) //nolint:gosec // 打乱顺序无需密码学安全的随机数
+	r.Shuffle(len(pos), func(i, j int) {
+		shuffled[pos[i]], shuffled[pos[j]] = shuffled[pos[j]], shuffled[pos[i]]
+	})
+	return shuffled
+}
@@ -0,0 +1,35 @@
+package service
+
+import (
+	"testing"
+
+	"QA-System/internal/model"
+)
+
+func TestShuffleOptionsKeepsPinnedPositions(t *testing.T) {
+	options := []model.Option{
+		{ID: 1, Content: "其他学院"},
+		{ID: 2, Content: "其它（请说明）"},
+		{ID: 3, Content: "A"},
+		{ID: 4, Content: "B"},
+		{ID: 5, Content: "以上都不是", Pinned: true},
+	}
+	moved := false
+	for seed := range uint64(20) {
+		shuffled := ShuffleOptions(options, seed, 1)
+		if len(shuffled) != len(options) {
+			t.Fatalf("ShuffleOptions() returned %d options, want %d", len(shuffled), len(options))
+		}
+		if shuffled[4].ID != 5 {
+			t.Fatalf("ShuffleOptions() moved the pinned option to %+v", shuffled)
+		}
+		// 只按固定标志判断, 内容含"其他"的选项同样参与打乱
+		moved = moved || shuffled[0].ID != 1 || shuffled[1].ID != 2
+	}
+	if !moved {
+		t.Error("ShuffleOptions() never moved options whose content mentions 其他")
+	}
+	if options[0].ID != 1 || options[4].ID != 5 {
+		t.Error("ShuffleOptions() modified the original slice")
+	}
+}
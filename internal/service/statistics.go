@@ -0,0 +1,160 @@
+package service
+
+import (
+	"sort"
+	"strings"
+
+	"QA-System/internal/dao"
+	"QA-System/internal/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// unknownGroup 没有对应统一验证记录的答卷所在的分组
+const unknownGroup = "未知"
+
+// GroupOptionCount 分组选项统计
+type GroupOptionCount struct {
+	SerialNum int    `json:"serial_num"` // 选项序号 0为其他
+	Content   string `json:"content"`    // 选项内容
+	Count     int    `json:"count"`      // 选项数量
+}
+
+// GroupQuestionStatistics 分组问题统计
+type GroupQuestionStatistics struct {
+	SerialNum    int                `json:"serial_num"`    // 问题序号
+	Question     string             `json:"question"`      // 问题内容
+	QuestionType int                `json:"question_type"` // 问题类型 1:单选 2:多选
+	Options      []GroupOptionCount `json:"options"`       // 选项统计
+}
+
+// GroupStatistics 分组统计
+type GroupStatistics struct {
+	Group      string                    `json:"group"`      // 分组名称
+	Total      int                       `json:"total"`      // 分组答卷数量
+	Statistics []GroupQuestionStatistics `json:"statistics"` // 选择题统计
+}
+
+// GetGroupStatistics 按统一验证记录中的学院、性别或用户类型对答卷分组, 统计各组选择题的选项数量
+// groupBy 为 college、gender 或 user_type
+func GetGroupStatistics(sid int, answerSheets []dao.AnswerSheet, questions []model.Question, groupBy string) (
+	[]GroupStatistics, error) {
+	records, err := d.GetRecordSheetsBySurveyID(ctx, sid)
+	if err != nil {
+		return nil, err
+	}
+	answerGroups := make(map[primitive.ObjectID]string, len(records))
+	for _, record := range records {
+		if record.AnswerID.IsZero() {
+			continue
+		}
+		answerGroups[record.AnswerID] = recordGroup(record, groupBy)
+	}
+	groups := make(map[string][]dao.AnswerSheet)
+	for _, answerSheet := range answerSheets {
+		group, ok := answerGroups[answerSheet.AnswerID]
+		if !ok {
+			group = unknownGroup
+		}
+		groups[group] = append(groups[group], answerSheet)
+	}
+
+	choiceQuestions := make([]model.Question, 0, len(questions))
+	options := make(map[int][]model.Option, len(questions))
+	for _, question := range questions {
+		if question.QuestionType != 1 && question.QuestionType != 2 {
+			continue
+		}
+		questionOptions, err := d.GetOptionsByQuestionID(ctx, question.ID)
+		if err != nil {
+			return nil, err
+		}
+		choiceQuestions = append(choiceQuestions, question)
+		options[question.ID] = questionOptions
+	}
+
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	result := make([]GroupStatistics, 0, len(names))
+	for _, name := range names {
+		result = append(result, GroupStatistics{
+			Group:      name,
+			Total:      len(groups[name]),
+			Statistics: countChoiceOptions(groups[name], choiceQuestions, options),
+		})
+	}
+	return result, nil
+}
+
+// recordGroup 获取统一验证记录所在的分组
+func recordGroup(record dao.RecordSheet, groupBy string) string {
+	var group string
+	switch groupBy {
+	case "college":
+		group = record.College
+	case "gender":
+		group = record.Gender
+	case "user_type":
+		group = record.UserTypeDesc
+	}
+	if group == "" {
+		return unknownGroup
+	}
+	return group
+}
+
+// countChoiceOptions 统计答卷中选择题各选项的数量, 不属于任何选项的答案计入"其他"
+func countChoiceOptions(answerSheets []dao.AnswerSheet, questions []model.Question,
+	options map[int][]model.Option) []GroupQuestionStatistics {
+	counts := make(map[int]map[string]int, len(questions))
+	for _, question := range questions {
+		counts[question.ID] = make(map[string]int)
+	}
+	for _, answerSheet := range answerSheets {
+		for _, answer := range answerSheet.Answers {
+			questionCounts, ok := counts[answer.QuestionID]
+			if !ok || answer.Content == "" {
+				continue
+			}
+			for _, content := range strings.Split(answer.Content, "┋") {
+				questionCounts[content]++
+			}
+		}
+	}
+	result := make([]GroupQuestionStatistics, 0, len(questions))
+	for _, question := range questions {
+		questionCounts := counts[question.ID]
+		optionCounts := make([]GroupOptionCount, 0, len(options[question.ID])+1)
+		other := 0
+		matched := make(map[string]bool, len(options[question.ID]))
+		for _, option := range options[question.ID] {
+			matched[option.Content] = true
+			optionCounts = append(optionCounts, GroupOptionCount{
+				SerialNum: option.SerialNum,
+				Content:   option.Content,
+				Count:     questionCounts[option.Content],
+			})
+		}
+		for content, count := range questionCounts {
+			if !matched[content] {
+				other += count
+			}
+		}
+		if question.OtherOption {
+			optionCounts = append(optionCounts, GroupOptionCount{
+				SerialNum: 0,
+				Content:   "其他",
+				Count:     other,
+			})
+		}
+		result = append(result, GroupQuestionStatistics{
+			SerialNum:    question.SerialNum,
+			Question:     question.Subject,
+			QuestionType: question.QuestionType,
+			Options:      optionCounts,
+		})
+	}
+	return result
+}
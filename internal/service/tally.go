@@ -0,0 +1,254 @@
+package service
+
+import (
+	"sort"
+	"strings"
+
+	"QA-System/internal/dao"
+	"QA-System/internal/model"
+	"QA-System/internal/pkg/code"
+)
+
+// 计票方式
+const (
+	TallyIRV   = "irv"   // 即时决选, 每轮淘汰票数最少的候选项直至有候选项过半
+	TallyBorda = "borda" // 波达计数, 排在第 i 位的候选项得 n-i 分(i 从 1 开始, n 为候选项数)
+)
+
+// TallyCandidate 候选项
+type TallyCandidate struct {
+	SerialNum int    `json:"serial_num"` // 选项序号
+	Content   string `json:"content"`    // 选项内容
+}
+
+// TallyRound 即时决选的一轮计票结果
+type TallyRound struct {
+	Round      int         `json:"round"`      // 轮次, 从 1 开始
+	Counts     map[int]int `json:"counts"`     // 选项序号对应的票数
+	Exhausted  int         `json:"exhausted"`  // 排序中已没有剩余候选项的废票数
+	Eliminated []int       `json:"eliminated"` // 本轮淘汰的选项序号, 票数并列最少时一起淘汰
+}
+
+// TallyResult 一道排序投票题的计票结果
+type TallyResult struct {
+	QuestionID int              `json:"question_id"`
+	SerialNum  int              `json:"serial_num"`
+	Subject    string           `json:"subject"`
+	Method     string           `json:"method"`
+	Ballots    int              `json:"ballots"`          // 有效选票的总权重
+	Candidates []TallyCandidate `json:"candidates"`       // 候选项
+	Rounds     []TallyRound     `json:"rounds,omitempty"` // 即时决选的各轮结果
+	Scores     map[int]int      `json:"scores,omitempty"` // 波达计数各选项得分
+	Winners    []int            `json:"winners"`          // 胜出的选项序号, 并列时有多个
+}
+
+// ballot 一张排序选票
+type ballot struct {
+	Preferences []int // 按偏好从高到低排列的选项序号
+	Weight      int   // 选票权重
+}
+
+// GetVoteTally 按排序选票计票, 选项的填写顺序即为偏好顺序, 只计入唯一且未被标记为无效的答卷
+// weighted 为 true 时按权重名单中的权重计票, 不在名单中的投票者权重为 1
+func GetVoteTally(survey *model.Survey, method string, weighted bool) ([]TallyResult, error) {
+	answerSheets, err := GetSurveyAnswersBySurveyID(survey.ID, dao.AnswerFilter{Unique: true})
+	if err != nil {
+		return nil, err
+	}
+	questions, err := d.GetQuestionsBySurveyID(ctx, survey.ID)
+	if err != nil {
+		return nil, err
+	}
+	var weights map[string]int
+	if weighted {
+		weights, err = getAnswerWeights(survey)
+		if err != nil {
+			return nil, err
+		}
+	}
+	results := make([]TallyResult, 0)
+	for _, question := range questions {
+		if question.QuestionType != 1 {
+			continue
+		}
+		options, err := d.GetOptionsByQuestionID(ctx, question.ID)
+		if err != nil {
+			return nil, err
+		}
+		result := TallyResult{
+			QuestionID: question.ID,
+			SerialNum:  question.SerialNum,
+			Subject:    question.Subject,
+			Method:     method,
+			Candidates: make([]TallyCandidate, 0, len(options)),
+		}
+		serialNums := make(map[string]int, len(options))
+		candidates := make([]int, 0, len(options))
+		for _, option := range options {
+			serialNums[option.Content] = option.SerialNum
+			candidates = append(candidates, option.SerialNum)
+			result.Candidates = append(result.Candidates, TallyCandidate{
+				SerialNum: option.SerialNum,
+				Content:   option.Content,
+			})
+		}
+		sort.Ints(candidates)
+		ballots := make([]ballot, 0, len(answerSheets))
+		for _, answerSheet := range answerSheets {
+			b := newBallot(answerSheet, question.ID, serialNums)
+			if len(b.Preferences) == 0 {
+				continue
+			}
+			if weighted {
+				if weight, ok := weights[answerSheet.AnswerID.Hex()]; ok {
+					b.Weight = weight
+				}
+			}
+			result.Ballots += b.Weight
+			ballots = append(ballots, b)
+		}
+		if method == TallyBorda {
+			result.Scores, result.Winners = bordaCount(candidates, ballots)
+		} else {
+			result.Rounds, result.Winners = instantRunoff(candidates, ballots)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// getAnswerWeights 根据统一验证记录和权重名单获取各答卷的权重
+func getAnswerWeights(survey *model.Survey) (map[string]int, error) {
+	if !survey.Verify {
+		return nil, code.WeightedVoteError
+	}
+	if survey.Anonymous {
+		return nil, code.AnonymousSurveyError
+	}
+	rosters, err := d.GetRostersBySurveyID(ctx, survey.ID, 4)
+	if err != nil {
+		return nil, err
+	}
+	stuWeights := make(map[string]int, len(rosters))
+	for _, roster := range rosters {
+		stuWeights[roster.StudentID] = int(roster.Weight)
+	}
+	records, err := d.GetRecordSheetsBySurveyID(ctx, survey.ID)
+	if err != nil {
+		return nil, err
+	}
+	weights := make(map[string]int, len(records))
+	for _, record := range records {
+		if weight, ok := stuWeights[record.StudentID]; ok && !record.AnswerID.IsZero() {
+			weights[record.AnswerID.Hex()] = weight
+		}
+	}
+	return weights, nil
+}
+
+// newBallot 从答卷中读取某题的排序选票, 忽略不存在和重复的选项
+func newBallot(answerSheet dao.AnswerSheet, qid int, serialNums map[string]int) ballot {
+	b := ballot{Weight: 1}
+	for _, answer := range answerSheet.Answers {
+		if answer.QuestionID != qid {
+			continue
+		}
+		seen := make(map[int]bool)
+		for _, content := range strings.Split(answer.Content, "┋") {
+			serialNum, ok := serialNums[content]
+			if !ok || seen[serialNum] {
+				continue
+			}
+			seen[serialNum] = true
+			b.Preferences = append(b.Preferences, serialNum)
+		}
+	}
+	return b
+}
+
+// instantRunoff 即时决选计票, 返回各轮结果和胜出的选项
+// 每轮按选票中排名最高且未被淘汰的候选项计票, 有候选项票数过半时胜出,
+// 否则淘汰票数最少的候选项(并列时一起淘汰); 剩余候选项票数全部相同时并列胜出
+func instantRunoff(candidates []int, ballots []ballot) ([]TallyRound, []int) {
+	rounds := make([]TallyRound, 0)
+	remaining := make(map[int]bool, len(candidates))
+	for _, candidate := range candidates {
+		remaining[candidate] = true
+	}
+	for len(remaining) > 0 {
+		round := TallyRound{Round: len(rounds) + 1, Counts: make(map[int]int, len(remaining))}
+		for candidate := range remaining {
+			round.Counts[candidate] = 0
+		}
+		active := 0
+		for _, b := range ballots {
+			top, ok := topPreference(b, remaining)
+			if !ok {
+				round.Exhausted += b.Weight
+				continue
+			}
+			round.Counts[top] += b.Weight
+			active += b.Weight
+		}
+		if active == 0 {
+			rounds = append(rounds, round)
+			return rounds, make([]int, 0)
+		}
+		leaders, most := extremeCandidates(round.Counts, func(a, b int) bool { return a > b })
+		if most*2 > active || len(leaders) == len(remaining) {
+			rounds = append(rounds, round)
+			return rounds, leaders
+		}
+		round.Eliminated, _ = extremeCandidates(round.Counts, func(a, b int) bool { return a < b })
+		for _, candidate := range round.Eliminated {
+			delete(remaining, candidate)
+		}
+		rounds = append(rounds, round)
+	}
+	return rounds, make([]int, 0)
+}
+
+// topPreference 获取选票中排名最高且未被淘汰的候选项
+func topPreference(b ballot, remaining map[int]bool) (int, bool) {
+	for _, candidate := range b.Preferences {
+		if remaining[candidate] {
+			return candidate, true
+		}
+	}
+	return 0, false
+}
+
+// extremeCandidates 获取票数最多或最少的候选项(按序号升序)及其票数, better 决定比较方向
+func extremeCandidates(counts map[int]int, better func(a, b int) bool) ([]int, int) {
+	result := make([]int, 0)
+	var value int
+	for candidate, count := range counts {
+		switch {
+		case len(result) == 0 || better(count, value):
+			result = []int{candidate}
+			value = count
+		case count == value:
+			result = append(result, candidate)
+		}
+	}
+	sort.Ints(result)
+	return result, value
+}
+
+// bordaCount 波达计数, 选票中未排序的候选项不得分, 返回各选项得分和胜出的选项
+func bordaCount(candidates []int, ballots []ballot) (map[int]int, []int) {
+	scores := make(map[int]int, len(candidates))
+	for _, candidate := range candidates {
+		scores[candidate] = 0
+	}
+	if len(ballots) == 0 {
+		return scores, make([]int, 0)
+	}
+	for _, b := range ballots {
+		for i, candidate := range b.Preferences {
+			scores[candidate] += (len(candidates) - 1 - i) * b.Weight
+		}
+	}
+	winners, _ := extremeCandidates(scores, func(a, b int) bool { return a > b })
+	return scores, winners
+}
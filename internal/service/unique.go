@@ -0,0 +1,234 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"QA-System/internal/dao"
+	"QA-System/internal/model"
+	"QA-System/internal/pkg/code"
+	"QA-System/internal/pkg/redis"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+)
+
+// uniqueClaim 答卷对唯一问题答案的占用
+type uniqueClaim struct {
+	ID       primitive.ObjectID // 占用记录ID
+	Inserted bool               // 是否为本次新增的占用记录
+	Previous primitive.ObjectID // 保留最新答卷时, 原先占用该答案的答卷ID
+}
+
+// normalizeUniqueAnswer 规范化唯一问题的答案, 忽略大小写和多余的空白
+func normalizeUniqueAnswer(answer string) string {
+	return strings.ToLower(strings.Join(strings.Fields(answer), " "))
+}
+
+// uniqueAnswerError 返回指明重复问题的 code.UniqueError
+func uniqueAnswerError(question *model.Question) *code.Error {
+	return code.NewError(code.UniqueError.Code, code.UniqueError.Level,
+		fmt.Sprintf("问题%d的填写内容与已有答卷重复，请重新填写！", question.SerialNum))
+}
+
+// IsUniqueError 判断错误是否为唯一问题答案重复
+func IsUniqueError(err error) (*code.Error, bool) {
+	var apiErr *code.Error
+	if errors.As(err, &apiErr) && apiErr.Code == code.UniqueError.Code {
+		return apiErr, true
+	}
+	return nil, false
+}
+
+// claimUniqueAnswers 占用答卷中唯一问题的答案
+// 拒绝重复时答案已被其他答卷占用则撤销本次占用并返回 code.UniqueError, 保留最新答卷时改由该答卷占用
+func claimUniqueAnswers(survey *model.Survey, answerSheet dao.AnswerSheet, uniques []*model.Question) (
+	[]uniqueClaim, error) {
+	contents := make(map[int]string, len(answerSheet.Answers))
+	for _, answer := range answerSheet.Answers {
+		contents[answer.QuestionID] = answer.Content
+	}
+	claims := make([]uniqueClaim, 0, len(uniques))
+	for _, question := range uniques {
+		value := normalizeUniqueAnswer(contents[question.ID])
+		if value == "" {
+			continue
+		}
+		entry := dao.UniqueAnswer{
+			ID:         primitive.NewObjectID(),
+			SurveyID:   survey.ID,
+			QuestionID: question.ID,
+			Value:      value,
+			AnswerID:   answerSheet.AnswerID,
+		}
+		claim, err := claimUniqueAnswer(survey, entry)
+		if errors.Is(err, code.UniqueError) {
+			releaseUniqueClaims(answerSheet.AnswerID, claims)
+			return nil, uniqueAnswerError(question)
+		} else if err != nil {
+			releaseUniqueClaims(answerSheet.AnswerID, claims)
+			return nil, err
+		}
+		claims = append(claims, claim)
+	}
+	return claims, nil
+}
+
+func claimUniqueAnswer(survey *model.Survey, entry dao.UniqueAnswer) (uniqueClaim, error) {
+	if survey.UniqueMode == 1 {
+		previous, err := d.ReplaceUniqueAnswer(ctx, entry)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return uniqueClaim{ID: entry.ID, Inserted: true}, nil
+		} else if err != nil {
+			return uniqueClaim{}, err
+		}
+		return uniqueClaim{ID: previous.ID, Previous: previous.AnswerID}, nil
+	}
+	err := d.InsertUniqueAnswer(ctx, entry)
+	if err == nil {
+		return uniqueClaim{ID: entry.ID, Inserted: true}, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return uniqueClaim{}, err
+	}
+	// 修改答卷时答案未变, 仍由该答卷占用
+	existing, err := d.GetUniqueAnswer(ctx, entry.SurveyID, entry.QuestionID, entry.Value)
+	if err != nil {
+		return uniqueClaim{}, err
+	}
+	if existing.AnswerID != entry.AnswerID {
+		return uniqueClaim{}, code.UniqueError
+	}
+	return uniqueClaim{ID: existing.ID}, nil
+}
+
+// releaseUniqueClaims 提交失败时撤销本次占用, 被取代的答案归还给原答卷
+func releaseUniqueClaims(answerID primitive.ObjectID, claims []uniqueClaim) {
+	inserted := make([]primitive.ObjectID, 0, len(claims))
+	for _, claim := range claims {
+		if claim.Inserted {
+			inserted = append(inserted, claim.ID)
+		} else if !claim.Previous.IsZero() && claim.Previous != answerID {
+			if err := d.RestoreUniqueAnswer(ctx, claim.ID, claim.Previous); err != nil {
+				zap.L().Error("Failed to restore unique answer", zap.Error(err))
+			}
+		}
+	}
+	if len(inserted) == 0 {
+		return
+	}
+	if err := d.DeleteUniqueAnswers(ctx, inserted); err != nil {
+		zap.L().Error("Failed to delete unique answers", zap.Error(err))
+	}
+}
+
+// commitUniqueClaims 提交成功后将被取代的答卷标记为不唯一, 修改答卷时释放不再使用的答案
+func commitUniqueClaims(answerID primitive.ObjectID, claims []uniqueClaim, edit bool) error {
+	keep := make([]primitive.ObjectID, 0, len(claims))
+	for _, claim := range claims {
+		keep = append(keep, claim.ID)
+		if !claim.Previous.IsZero() && claim.Previous != answerID {
+			if err := displaceAnswerSheet(claim.Previous); err != nil {
+				return err
+			}
+		}
+	}
+	if !edit {
+		return nil
+	}
+	return d.DeleteUniqueAnswersByAnswerID(ctx, answerID, keep)
+}
+
+// uniqueBackfillBatch 回填唯一问题答案时每批读取的答卷数
+const uniqueBackfillBatch = 500
+
+func uniqueBackfilledKey(sid int) string {
+	return fmt.Sprintf("survey:%d:unique:backfilled", sid)
+}
+
+// BackfillUniqueAnswers 为唯一索引启用前提交的答卷补充答案占用记录, 已有记录时跳过, 可重复执行
+// 回填完成的问卷会被标记, 之后启动时不再读取其答卷
+func BackfillUniqueAnswers() error {
+	questions, err := d.GetUniqueQuestions(ctx)
+	if err != nil {
+		return err
+	}
+	uniques := make(map[int][]int)
+	for _, question := range questions {
+		uniques[question.SurveyID] = append(uniques[question.SurveyID], question.ID)
+	}
+	for surveyID, qids := range uniques {
+		backfilled, err := redis.RedisClient.Exists(ctx, uniqueBackfilledKey(surveyID)).Result()
+		if err != nil {
+			return err
+		}
+		if backfilled > 0 {
+			continue
+		}
+		if err := backfillSurveyUniqueAnswers(surveyID, qids); err != nil {
+			return err
+		}
+		if err := redis.RedisClient.Set(ctx, uniqueBackfilledKey(surveyID), 1, 0).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backfillSurveyUniqueAnswers 按提交先后回填问卷的唯一问题答案, 历史数据中的重复答案保留最早的占用
+func backfillSurveyUniqueAnswers(surveyID int, qids []int) error {
+	page := dao.AnswerPage{Limit: uniqueBackfillBatch}
+	for {
+		answerSheets, err := d.GetAnswerSheetBySurveyID(ctx, surveyID, dao.AnswerFilter{}, page)
+		if err != nil {
+			return err
+		}
+		for _, answerSheet := range answerSheets {
+			if !answerSheet.Unique {
+				continue
+			}
+			if err := backfillUniqueAnswer(answerSheet, qids); err != nil {
+				return err
+			}
+		}
+		if len(answerSheets) < uniqueBackfillBatch {
+			return nil
+		}
+		page.After = answerSheets[len(answerSheets)-1].AnswerID
+	}
+}
+
+func backfillUniqueAnswer(answerSheet dao.AnswerSheet, qids []int) error {
+	contents := make(map[int]string, len(answerSheet.Answers))
+	for _, answer := range answerSheet.Answers {
+		contents[answer.QuestionID] = answer.Content
+	}
+	for _, qid := range qids {
+		value := normalizeUniqueAnswer(contents[qid])
+		if value == "" {
+			continue
+		}
+		err := d.InsertUniqueAnswer(ctx, dao.UniqueAnswer{
+			ID:         primitive.NewObjectID(),
+			SurveyID:   answerSheet.SurveyID,
+			QuestionID: qid,
+			Value:      value,
+			AnswerID:   answerSheet.AnswerID,
+		})
+		if mongo.IsDuplicateKeyError(err) {
+			existing, err := d.GetUniqueAnswer(ctx, answerSheet.SurveyID, qid, value)
+			if err != nil {
+				return err
+			}
+			if existing.AnswerID != answerSheet.AnswerID {
+				zap.L().Warn("Duplicate unique answer in existing answer sheets",
+					zap.Int("survey_id", answerSheet.SurveyID), zap.Int("question_id", qid),
+					zap.String("answer_id", answerSheet.AnswerID.Hex()))
+			}
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
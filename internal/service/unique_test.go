@@ -0,0 +1,75 @@
+package service
+
+import (
+	"testing"
+
+	"QA-System/internal/model"
+	database "QA-System/internal/pkg/database/mongodb"
+	"github.com/glebarez/sqlite"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestBackfillUniqueAnswersRunsOncePerSurvey(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("backfill", func(mt *mtest.T) {
+		server := useMiniredis(mt.T)
+		db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+		if err != nil {
+			mt.Fatal(err)
+		}
+		sqlDB, err := db.DB()
+		if err != nil {
+			mt.Fatal(err)
+		}
+		sqlDB.SetMaxOpenConns(1)
+		mt.Cleanup(func() { _ = sqlDB.Close() })
+		if err := db.AutoMigrate(&model.Question{}); err != nil {
+			mt.Fatal(err)
+		}
+		question := model.Question{SurveyID: 1, SerialNum: 1, QuestionType: 3, Unique: true}
+		if err := db.Create(&question).Error; err != nil {
+			mt.Fatal(err)
+		}
+		Init(db, mt.DB)
+		database.QA, database.Unique = "qa", "unique"
+
+		// 读取一份答卷并占用其答案
+		sheet := bson.D{
+			{Key: "_id", Value: primitive.NewObjectID()},
+			{Key: "surveyid", Value: 1},
+			{Key: "unique", Value: true},
+			{Key: "answers", Value: bson.A{bson.D{{Key: "questionid", Value: question.ID}, {Key: "content", Value: " A "}}}},
+		}
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "test.qa", mtest.FirstBatch, sheet),
+			mtest.CreateSuccessResponse(),
+		)
+		if err := BackfillUniqueAnswers(); err != nil {
+			mt.Fatal(err)
+		}
+		if !server.Exists(uniqueBackfilledKey(1)) {
+			mt.Fatal("BackfillUniqueAnswers() did not mark the survey as backfilled")
+		}
+		var inserted bson.Raw
+		for event := mt.GetStartedEvent(); event != nil; event = mt.GetStartedEvent() {
+			if event.CommandName == "insert" {
+				inserted = event.Command.Lookup("documents").Array().Index(0).Value().Document()
+			}
+		}
+		if inserted == nil || inserted.Lookup("value").StringValue() != "a" {
+			mt.Fatalf("BackfillUniqueAnswers() inserted %v, want the normalized answer", inserted)
+		}
+
+		// 已回填的问卷不再读取答卷, 没有准备的模拟响应时访问 MongoDB 会失败
+		if err := BackfillUniqueAnswers(); err != nil {
+			mt.Fatalf("BackfillUniqueAnswers() = %v on a backfilled survey, want nil", err)
+		}
+		if event := mt.GetStartedEvent(); event != nil {
+			mt.Fatalf("BackfillUniqueAnswers() sent %s to MongoDB for a backfilled survey", event.CommandName)
+		}
+	})
+}
@@ -13,7 +13,8 @@ import (
 
 	"QA-System/internal/dao"
 	"QA-System/internal/model"
-	"github.com/gin-gonic/gin"
+	"QA-System/internal/pkg/code"
+	"QA-System/internal/pkg/utils"
 	"github.com/zjutjh/WeJH-SDK/oauth"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.uber.org/zap"
@@ -35,6 +36,22 @@ func GetQuestionsBySurveyID(sid int) ([]model.Question, error) {
 	return questions, err
 }
 
+// GetSectionsBySurveyID 根据问卷ID获取分页
+func GetSectionsBySurveyID(sid int) ([]model.Section, error) {
+	return d.GetSectionsBySurveyID(ctx, sid)
+}
+
+// AnswerableQuestions 过滤掉展示块, 返回需要作答的题目
+func AnswerableQuestions(questions []model.Question) []model.Question {
+	result := make([]model.Question, 0, len(questions))
+	for _, question := range questions {
+		if question.QuestionType != 7 {
+			result = append(result, question)
+		}
+	}
+	return result
+}
+
 // GetOptionsByQuestionID 根据问题ID获取选项
 func GetOptionsByQuestionID(questionId int) ([]model.Option, error) {
 	var options []model.Option
@@ -50,36 +67,155 @@ func GetQuestionByID(id int) (*model.Question, error) {
 }
 
 // SubmitSurvey 提交问卷
-func SubmitSurvey(sid int, data []dao.QuestionsList, t string) error {
+func SubmitSurvey(sid int, stuId string, data []dao.QuestionsList, t string, meta *dao.SubmitMeta) (
+	dao.AnswerSheet, error) {
+	survey, err := d.GetSurveyByID(ctx, sid)
+	if err != nil {
+		return dao.AnswerSheet{}, err
+	}
+	answerSheet, uniques, err := newAnswerSheet(survey, data, t)
+	if err != nil {
+		return dao.AnswerSheet{}, err
+	}
+	answerSheet.AnswerID = primitive.NewObjectID()
+	answerSheet.Meta = meta
+	// 允许修改答卷时记录学号, 以便填写者获取自己的答卷
+	// 匿名问卷只凭提交回执修改答卷, 不记录学号的 HMAC, 以免对名单中的学号计算 HMAC 后关联答卷
+	if survey.Verify && survey.AllowEdit && !survey.Anonymous {
+		answerSheet.StudentID = stuId
+	}
+	// 先占用填写名额, 保证填写数量不超过问卷上限
+	ok, err := d.IncreaseSurveyNum(ctx, sid)
+	if err != nil {
+		return dao.AnswerSheet{}, err
+	}
+	if !ok {
+		return dao.AnswerSheet{}, code.SurveyFullError
+	}
+	done := beginVoteCountWrite(survey)
+	defer done()
+	// 占用唯一问题的答案, 答案重复时不保存答卷
+	claims, err := claimUniqueAnswers(survey, answerSheet, uniques)
+	if err == nil {
+		err = d.SaveAnswerSheet(ctx, answerSheet)
+		if err != nil {
+			releaseUniqueClaims(answerSheet.AnswerID, claims)
+		}
+	}
+	if err != nil {
+		// 保存失败时归还名额
+		if e := d.DecreaseSurveyNum(ctx, sid); e != nil {
+			zap.L().Error("Failed to decrease survey num", zap.Int("survey_id", sid), zap.Error(e))
+		}
+		return dao.AnswerSheet{}, err
+	}
+	if err := commitUniqueClaims(answerSheet.AnswerID, claims, false); err != nil {
+		zap.L().Error("Failed to commit unique answers", zap.Int("survey_id", sid), zap.Error(err))
+	}
+	updateVoteCounts(survey, answerSheet, 1)
+	// 达到上限后自动截止问卷
+	return answerSheet, d.CloseFullSurvey(ctx, sid)
+}
+
+// GetLatestSubmission 获取填写者在问卷中最近提交的答卷
+func GetLatestSubmission(sid int, stuId string) (*dao.AnswerSheet, error) {
+	return d.GetLatestAnswerSheetByStudentID(ctx, sid, stuId)
+}
+
+// receiptExpiration 提交回执的有效期
+const receiptExpiration = 180 * 24 * time.Hour
+
+// NewReceipt 生成答卷的提交回执
+func NewReceipt(answerSheet dao.AnswerSheet) string {
+	return utils.NewReceiptJWT(answerSheet.SurveyID, answerSheet.AnswerID.Hex(), receiptExpiration)
+}
+
+// GetSubmissionByReceipt 根据提交回执获取答卷
+func GetSubmissionByReceipt(receipt string) (*dao.AnswerSheet, error) {
+	sid, answerID, err := utils.ParseReceiptJWT(receipt)
+	if err != nil {
+		return nil, code.ReceiptInvalid
+	}
+	objectID, err := primitive.ObjectIDFromHex(answerID)
+	if err != nil {
+		return nil, code.ReceiptInvalid
+	}
+	answerSheet, err := d.GetAnswerSheetByAnswerID(ctx, objectID)
+	if err != nil {
+		return nil, err
+	}
+	if answerSheet.SurveyID != sid {
+		return nil, code.ReceiptInvalid
+	}
+	return answerSheet, nil
+}
+
+// EditSubmission 修改已提交的答卷, 不占用新的填写名额
+func EditSubmission(survey *model.Survey, previous *dao.AnswerSheet, data []dao.QuestionsList, t string) (
+	dao.AnswerSheet, error) {
+	answerSheet, uniques, err := newAnswerSheet(survey, data, t)
+	if err != nil {
+		return dao.AnswerSheet{}, err
+	}
+	answerSheet.AnswerID = previous.AnswerID
+	answerSheet.StudentID = previous.StudentID
+	answerSheet.Invalid = previous.Invalid
+	done := beginVoteCountWrite(survey)
+	defer done()
+	claims, err := claimUniqueAnswers(survey, answerSheet, uniques)
+	if err != nil {
+		return dao.AnswerSheet{}, err
+	}
+	err = d.ReplaceAnswerSheet(ctx, answerSheet, *previous)
+	if err != nil {
+		releaseUniqueClaims(answerSheet.AnswerID, claims)
+		return dao.AnswerSheet{}, err
+	}
+	if err := commitUniqueClaims(answerSheet.AnswerID, claims, true); err != nil {
+		zap.L().Error("Failed to commit unique answers", zap.Int("survey_id", survey.ID), zap.Error(err))
+	}
+	// 实时计数扣除原答卷并计入修改后的答卷
+	if isCounted(*previous) {
+		updateVoteCounts(survey, *previous, -1)
+	}
+	if isCounted(answerSheet) {
+		updateVoteCounts(survey, answerSheet, 1)
+	}
+	return answerSheet, nil
+}
+
+// newAnswerSheet 根据提交内容构建答卷, 返回答卷和需要唯一的问题
+func newAnswerSheet(survey *model.Survey, data []dao.QuestionsList, t string) (
+	dao.AnswerSheet, []*model.Question, error) {
 	var answerSheet dao.AnswerSheet
-	answerSheet.SurveyID = sid
+	answerSheet.SurveyID = survey.ID
 	answerSheet.Time = t
 	answerSheet.Unique = true
-	answerSheet.AnswerID = primitive.NewObjectID()
-	qids := make([]int, 0)
+	uniques := make([]*model.Question, 0)
+	questions := make(map[int]*model.Question, len(data))
 	for _, q := range data {
 		var answer dao.Answer
 		question, err := d.GetQuestionByID(ctx, q.QuestionID)
 		if err != nil {
-			return err
+			return dao.AnswerSheet{}, nil, err
 		}
+		questions[question.ID] = question
 		if question.QuestionType == 3 && question.Unique {
-			qids = append(qids, q.QuestionID)
+			uniques = append(uniques, question)
 		}
 		answer.QuestionID = q.QuestionID
 		answer.Content = q.Answer
 		answerSheet.Answers = append(answerSheet.Answers, answer)
 	}
-	err := d.SaveAnswerSheet(ctx, answerSheet, qids)
-	if err != nil {
-		return err
+	// 测验问卷自动批改
+	if survey.Type == 2 {
+		gradeAnswerSheet(&answerSheet, questions)
 	}
-	err = d.IncreaseSurveyNum(ctx, sid)
-	return err
+	return answerSheet, uniques, nil
 }
 
 // CreateOauthRecord 创建一条统一验证记录
-func CreateOauthRecord(userInfo oauth.UserInfo, t time.Time, sid int) error {
+func CreateOauthRecord(userInfo oauth.UserInfo, t time.Time, sid int, answerID primitive.ObjectID) error {
 	sheet := dao.RecordSheet{
 		College:      userInfo.College,
 		Name:         userInfo.Name,
@@ -88,10 +224,17 @@ func CreateOauthRecord(userInfo oauth.UserInfo, t time.Time, sid int) error {
 		UserTypeDesc: userInfo.UserTypeDesc,
 		Gender:       userInfo.Gender,
 		Time:         t,
+		AnswerID:     answerID,
 	}
 	return d.SaveRecordSheet(ctx, sheet, sid)
 }
 
+// CreateAnonymousRecord 为匿名问卷创建一条统一验证记录
+// 仅保存学号的 HMAC 用于统计填写情况, 不保存个人信息、提交时间和答卷ID, 无法与答卷关联
+func CreateAnonymousRecord(respondentID string, sid int) error {
+	return d.SaveAnonymousRecordSheet(ctx, dao.RecordSheet{StudentID: respondentID}, sid)
+}
+
 // ConvertToJPEG 将图片转换为 JPEG 格式
 func ConvertToJPEG(reader io.Reader) (io.Reader, error) {
 	img, _, err := image.Decode(reader)
@@ -131,14 +274,3 @@ func SaveFile(reader io.Reader, path string) error {
 	_, err = io.Copy(outFile, reader)
 	return err
 }
-
-// UpdateVoteLimit 更新投票限制
-func UpdateVoteLimit(c *gin.Context, stuId string, surveyID int, isNew bool, durationType string) error {
-	if isNew {
-		if durationType == "dailyLimit" {
-			return SetUserLimit(c, stuId, surveyID, 1, durationType)
-		}
-		return SetUserSumLimit(c, stuId, surveyID, 1, durationType)
-	}
-	return InscUserLimit(c, stuId, surveyID, durationType)
-}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"sort"
+	"time"
+
+	"QA-System/internal/model"
+	"QA-System/internal/pkg/code"
+	"QA-System/internal/pkg/utils"
+)
+
+// CheckResultVisibility 按问卷设置判断填写者是否可以查看投票结果, 不可查看时返回对应错误
+func CheckResultVisibility(survey *model.Survey, token string) error {
+	switch survey.ResultVisible {
+	case 1:
+		// 截止时间已过或问卷已截止后公开
+		if survey.Status != 3 && (survey.Deadline.IsZero() || survey.Deadline.After(time.Now())) {
+			return code.ResultHiddenError
+		}
+	case 2:
+		// 只有统一验证问卷能确认填写者是否已投票
+		if !survey.Verify {
+			return code.ResultHiddenError
+		}
+		userInfo, err := utils.ParseJWT(token)
+		if err != nil {
+			return code.ResultNotVotedError
+		}
+		respondentID, err := RespondentID(survey, userInfo.StudentID)
+		if err != nil {
+			return err
+		}
+		voted, err := d.HasRecordSheet(ctx, survey.ID, respondentID)
+		if err != nil {
+			return err
+		}
+		if !voted {
+			return code.ResultNotVotedError
+		}
+	case 3:
+		return code.ResultHiddenError
+	}
+	return nil
+}
+
+// LimitVoteCounts 按问卷设置只保留每题排名前N的选项计数, 票数相同的选项排名相同
+func LimitVoteCounts(survey *model.Survey, counts VoteCounts) VoteCounts {
+	if survey.ResultTopN == 0 {
+		return counts
+	}
+	limited := VoteCounts{Total: counts.Total, Options: make(map[int]map[int]int, len(counts.Options))}
+	for qid, options := range counts.Options {
+		values := make([]int, 0, len(options))
+		for _, count := range options {
+			values = append(values, count)
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(values)))
+		// 第N名的票数, 不少于该票数的选项都公开
+		threshold := values[min(int(survey.ResultTopN), len(values))-1]
+		for serialNum, count := range options {
+			if count >= threshold {
+				ensureMap(limited.Options, qid)[serialNum] = count
+			}
+		}
+	}
+	return limited
+}
@@ -38,6 +38,15 @@ func main() {
 	if err := utils.Init(); err != nil {
 		zap.L().Fatal(err.Error())
 	}
+	// 匿名问卷的答卷不保留可与名单关联的学号 HMAC
+	if err := service.ClearAnonymousStudentIDs(); err != nil {
+		zap.L().Error("Failed to clear student IDs from anonymous answer sheets", zap.Error(err))
+	}
+	// 为唯一索引启用前提交的答卷补充答案占用记录
+	// 回填失败时未完成的问卷在下次启动时继续回填
+	if err := service.BackfillUniqueAnswers(); err != nil {
+		zap.L().Error("Failed to backfill unique answers", zap.Error(err))
+	}
 
 	// 初始化gin
 	r := gin.Default()